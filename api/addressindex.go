@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"path/filepath"
+	"scp-app-api/spdbridge"
+	"sync/atomic"
+	"time"
+)
+
+const addressIndexFile = "addressindex.db"
+
+//addressIndexBatchSize is the number of blocks downloaded from spd and written to the index in a single transaction
+const addressIndexBatchSize = 100
+
+//addressIndexMaxLag is how many blocks the index can be behind the consensus height while serving lookups, it's
+//behind for a sync interval after every new block. Further behind, such as during the first sync, lookups are made
+//to the spd explorer
+const addressIndexMaxLag = 3
+
+var (
+	indexBlocksBucket       = []byte("blocks")
+	indexTransactionsBucket = []byte("transactions")
+	indexAddressesBucket    = []byte("addresses")
+	indexPayoutsBucket      = []byte("payouts")
+)
+
+type (
+	//addressIndex maps addresses to the confirmed transactions related to them, so that the patched
+	//spd endpoint /explorer/addresses/batch is not needed. It's built walking the blocks of spd's consensus
+	addressIndex struct {
+		//next is the height of the next block to index, it's first so that it's aligned for atomic access
+		next uint64
+		db   *bolt.DB
+	}
+
+	//indexedBlock is what's stored for each block, it holds what's needed to revert the block in case of reorgs.
+	//The miner payouts are recorded as a transaction with the id of the block
+	indexedBlock struct {
+		Id           string               `json:"id"`
+		Transactions []indexedTransaction `json:"transactions"`
+	}
+
+	//indexedTransaction holds the keys the transaction is indexed by: the addresses related to it and the ids of the
+	//file contracts it forms, revises or proves
+	indexedTransaction struct {
+		Id        string   `json:"id"`
+		Addresses []string `json:"addresses"`
+	}
+)
+
+var localIndex *addressIndex = nil
+
+//StartAddressIndex opens the address index in dataDir, starts keeping it updated and uses it in place of the spd explorer
+func StartAddressIndex(dataDir string) error {
+
+	index, err := openAddressIndex(filepath.Join(dataDir, addressIndexFile))
+	if err != nil {
+		return err
+	}
+	localIndex = index
+	explorerAddresses, explorerContract := fetchExplorerAddresses, fetchContractTransactions
+	fetchExplorerAddresses = func(ctx context.Context, addresses []string) (*spdbridge.AddressesBatchResp, error) {
+		if !index.caughtUp() {
+			return explorerAddresses(ctx, addresses)
+		}
+		return index.AddressesBatch(ctx, addresses)
+	}
+	fetchContractTransactions = func(ctx context.Context, contractId string) ([]spdbridge.ExplorerTransaction, error) {
+		if !index.caughtUp() {
+			return explorerContract(ctx, contractId)
+		}
+		return index.ContractTransactions(ctx, contractId)
+	}
+
+	go syncAddressIndex()
+	return nil
+
+}
+
+func syncAddressIndex() {
+
+	changed, err := localIndex.update()
+	if err != nil {
+		fmt.Printf("Error while updating the address index: %v\n", err)
+	}
+	if changed {
+		//The explorer cache may hold lookups made while the index was behind the consensus height
+		height, _, _ := localIndex.tip()
+		invalidateExplorerCache(height)
+	}
+
+	time.Sleep(networkSyncInterval)
+	go syncAddressIndex()
+
+}
+
+//openAddressIndex opens, creating it if needed, the address index stored at path
+func openAddressIndex(path string) (*addressIndex, error) {
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{indexBlocksBucket, indexTransactionsBucket, indexAddressesBucket, indexPayoutsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	index := &addressIndex{db: db}
+	next, _, err := index.tip()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	atomic.StoreUint64(&index.next, next)
+	return index, nil
+
+}
+
+//AddressesBatch returns the indexed transactions of the addresses requested, in the same format of the spd explorer
+func (index *addressIndex) AddressesBatch(_ context.Context, addresses []string) (*spdbridge.AddressesBatchResp, error) {
+
+	var resp spdbridge.AddressesBatchResp
+	err := index.db.View(func(tx *bolt.Tx) error {
+		transactionsBucket := tx.Bucket(indexTransactionsBucket)
+		payoutsBucket := tx.Bucket(indexPayoutsBucket)
+		cursor := tx.Bucket(indexAddressesBucket).Cursor()
+
+		for _, address := range addresses {
+			explorerAddress := spdbridge.ExplorerAddress{Address: address}
+			prefix := addressKeyPrefix(address)
+			for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+				//Keys are sorted by height, so the transactions are returned in chronological order
+				id := k[len(prefix)+8:]
+				if payout := payoutsBucket.Get(id); payout != nil {
+					var block spdbridge.ExplorerBlock
+					if err := json.Unmarshal(payout, &block); err != nil {
+						return err
+					}
+					explorerAddress.Blocks = append(explorerAddress.Blocks, block)
+					continue
+				}
+				var transaction spdbridge.ExplorerTransaction
+				if err := json.Unmarshal(transactionsBucket.Get(id), &transaction); err != nil {
+					return err
+				}
+				explorerAddress.Transactions = append(explorerAddress.Transactions, transaction)
+			}
+			if len(explorerAddress.Transactions) > 0 || len(explorerAddress.Blocks) > 0 {
+				resp.Addresses = append(resp.Addresses, explorerAddress)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+
+}
+
+//ContractTransactions returns the indexed transactions forming, revising or proving the file contract with the id
+//provided, in the same format of the spd explorer
+func (index *addressIndex) ContractTransactions(ctx context.Context, contractId string) ([]spdbridge.ExplorerTransaction, error) {
+
+	resp, err := index.AddressesBatch(ctx, []string{contractId})
+	if err != nil || len(resp.Addresses) == 0 {
+		return nil, err
+	}
+	return resp.Addresses[0].Transactions, nil
+
+}
+
+//Transaction returns the indexed transaction with the id provided, or nil if it's not indexed
+func (index *addressIndex) Transaction(id string) (*spdbridge.ExplorerTransaction, error) {
+
+	var transaction *spdbridge.ExplorerTransaction
+	err := index.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(indexTransactionsBucket).Get([]byte(id))
+		if value == nil {
+			return nil
+		}
+		transaction = &spdbridge.ExplorerTransaction{}
+		return json.Unmarshal(value, transaction)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+
+}
+
+//caughtUp returns whether the index is close enough to the consensus height to serve lookups
+func (index *addressIndex) caughtUp() bool {
+	data := networkData
+	return data != nil && atomic.LoadUint64(&index.next)+addressIndexMaxLag > data.ConsensusHeight
+}
+
+//tip returns the height of the next block to index and the id of the last indexed block
+func (index *addressIndex) tip() (next uint64, lastId string, err error) {
+
+	err = index.db.View(func(tx *bolt.Tx) error {
+		k, v := tx.Bucket(indexBlocksBucket).Cursor().Last()
+		if k == nil {
+			return nil
+		}
+		var block indexedBlock
+		if err := json.Unmarshal(v, &block); err != nil {
+			return err
+		}
+		next = binary.BigEndian.Uint64(k) + 1
+		lastId = block.Id
+		return nil
+	})
+	return next, lastId, err
+
+}
+
+//update indexes the blocks added to spd's consensus since the last update, reverting
+//the indexed blocks which are no longer part of the chain. Returns whether the index changed
+func (index *addressIndex) update() (changed bool, err error) {
+
+	consensus, err := spdbridge.GetConsensus()
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		next, lastId, err := index.tip()
+		if err != nil {
+			return changed, err
+		}
+
+		//spd reorged to a chain which is not longer than the indexed one
+		if next > consensus.Height+1 || (next == consensus.Height+1 && lastId != consensus.CurrentBlock) {
+			if err := index.revertBlock(next - 1); err != nil {
+				return changed, err
+			}
+			atomic.StoreUint64(&index.next, next-1)
+			changed = true
+			continue
+		}
+		if next == consensus.Height+1 {
+			return changed, nil
+		}
+
+		var blocks []*spdbridge.ConsensusBlock
+		parentId := lastId
+		for height := next; height <= consensus.Height && len(blocks) < addressIndexBatchSize; height++ {
+			block, err := spdbridge.GetConsensusBlock(height)
+			if err != nil {
+				return changed, err
+			}
+			if height > 0 && block.ParentId != parentId {
+				break
+			}
+			blocks = append(blocks, block)
+			parentId = block.Id
+		}
+
+		//The first block doesn't extend the indexed chain, so the indexed tip has been reorged
+		if len(blocks) == 0 {
+			if next == 0 {
+				return changed, errors.New("genesis block not available")
+			}
+			if err := index.revertBlock(next - 1); err != nil {
+				return changed, err
+			}
+			atomic.StoreUint64(&index.next, next-1)
+			changed = true
+			continue
+		}
+
+		if err := index.applyBlocks(blocks); err != nil {
+			return changed, err
+		}
+		atomic.StoreUint64(&index.next, blocks[len(blocks)-1].Height+1)
+		changed = true
+		if verbose {
+			fmt.Printf("Address index synced to height %v\n", blocks[len(blocks)-1].Height)
+		}
+	}
+
+}
+
+//applyBlocks adds the transactions and the miner payouts of the blocks provided to the index
+func (index *addressIndex) applyBlocks(blocks []*spdbridge.ConsensusBlock) error {
+
+	return index.db.Update(func(tx *bolt.Tx) error {
+		blocksBucket := tx.Bucket(indexBlocksBucket)
+		transactionsBucket := tx.Bucket(indexTransactionsBucket)
+		addressesBucket := tx.Bucket(indexAddressesBucket)
+		payoutsBucket := tx.Bucket(indexPayoutsBucket)
+
+		for _, block := range blocks {
+			record := indexedBlock{Id: block.Id}
+			if len(block.MinerPayouts) > 0 {
+				explorerBlock := spdbridge.ExplorerBlock{
+					BlockId:  block.Id,
+					Height:   block.Height,
+					RawBlock: spdbridge.ExplorerRawBlock{Timestamp: block.Timestamp, MinerPayouts: block.MinerPayouts},
+				}
+				var addresses []string
+				for i, payout := range block.MinerPayouts {
+					id, err := spdbridge.MinerPayoutId(block.Id, uint64(i))
+					if err != nil {
+						return err
+					}
+					explorerBlock.MinerPayoutIds = append(explorerBlock.MinerPayoutIds, id)
+					addresses = append(addresses, payout.UnlockHash)
+				}
+				payouts, err := json.Marshal(explorerBlock)
+				if err != nil {
+					return err
+				}
+				if err := payoutsBucket.Put([]byte(block.Id), payouts); err != nil {
+					return err
+				}
+				addresses = uniqueStrings(addresses)
+				for _, address := range addresses {
+					if err := addressesBucket.Put(addressKey(address, block.Height, block.Id), nil); err != nil {
+						return err
+					}
+				}
+				record.Transactions = append(record.Transactions, indexedTransaction{Id: block.Id, Addresses: addresses})
+			}
+			for _, consensusTransaction := range block.Transactions {
+				transaction, err := json.Marshal(spdbridge.ExplorerTransaction{
+					RawTransaction: consensusTransaction.RawTransaction,
+					BlockTimestamp: block.Timestamp,
+					Id:             consensusTransaction.Id,
+					Height:         block.Height,
+				})
+				if err != nil {
+					return err
+				}
+				if err := transactionsBucket.Put([]byte(consensusTransaction.Id), transaction); err != nil {
+					return err
+				}
+
+				addresses := append(transactionAddresses(consensusTransaction.RawTransaction), transactionContracts(consensusTransaction.RawTransaction)...)
+				for _, address := range addresses {
+					if err := addressesBucket.Put(addressKey(address, block.Height, consensusTransaction.Id), nil); err != nil {
+						return err
+					}
+				}
+				record.Transactions = append(record.Transactions, indexedTransaction{
+					Id:        consensusTransaction.Id,
+					Addresses: addresses,
+				})
+			}
+
+			value, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := blocksBucket.Put(heightKey(block.Height), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+}
+
+//revertBlock removes the block at the height provided, and its transactions, from the index
+func (index *addressIndex) revertBlock(height uint64) error {
+
+	return index.db.Update(func(tx *bolt.Tx) error {
+		blocksBucket := tx.Bucket(indexBlocksBucket)
+		transactionsBucket := tx.Bucket(indexTransactionsBucket)
+		addressesBucket := tx.Bucket(indexAddressesBucket)
+		payoutsBucket := tx.Bucket(indexPayoutsBucket)
+
+		var record indexedBlock
+		if err := json.Unmarshal(blocksBucket.Get(heightKey(height)), &record); err != nil {
+			return err
+		}
+		for _, transaction := range record.Transactions {
+			for _, address := range transaction.Addresses {
+				if err := addressesBucket.Delete(addressKey(address, height, transaction.Id)); err != nil {
+					return err
+				}
+			}
+			if err := transactionsBucket.Delete([]byte(transaction.Id)); err != nil {
+				return err
+			}
+			if err := payoutsBucket.Delete([]byte(transaction.Id)); err != nil {
+				return err
+			}
+		}
+		return blocksBucket.Delete(heightKey(height))
+	})
+
+}
+
+//transactionAddresses returns the addresses receiving an SCP or SPF output, spending an input, receiving the
+//dividends claimed by an SPF input or paid by a file contract of the transaction
+func transactionAddresses(transaction spdbridge.RawTransaction) []string {
+
+	var addresses []string
+	for _, output := range transaction.ScpOutputs {
+		addresses = append(addresses, output.UnlockHash)
+	}
+	var contractOutputs [][]spdbridge.ScpOutput
+	for _, contract := range transaction.FileContracts {
+		contractOutputs = append(contractOutputs, contract.ValidProofOutputs, contract.MissedProofOutputs)
+	}
+	for _, revision := range transaction.FileContractRevisions {
+		contractOutputs = append(contractOutputs, revision.NewValidProofOutputs, revision.NewMissedProofOutputs)
+	}
+	for _, outputs := range contractOutputs {
+		for _, output := range outputs {
+			addresses = append(addresses, output.UnlockHash)
+		}
+	}
+	for _, input := range transaction.ScpInputs {
+		address, err := input.UnlockConditions.UnlockHash()
+		if err == nil {
+			addresses = append(addresses, address)
+		}
+	}
+	for _, output := range transaction.SpfOutputs {
+		addresses = append(addresses, output.UnlockHash)
+	}
+	for _, input := range transaction.SpfInputs {
+		address, err := input.UnlockConditions.UnlockHash()
+		if err == nil {
+			addresses = append(addresses, address)
+		}
+		addresses = append(addresses, input.ClaimUnlockHash)
+	}
+	return uniqueStrings(addresses)
+
+}
+
+//transactionContracts returns the ids of the file contracts formed, revised or proved by the transaction, which are
+//indexed as addresses so that the transactions of a contract can be looked up the same way
+func transactionContracts(rawTransaction spdbridge.RawTransaction) []string {
+
+	var ids []string
+	transaction := spdbridge.Transaction(rawTransaction)
+	for i := range transaction.FileContracts {
+		id, err := transaction.FileContractId(uint64(i))
+		if err == nil {
+			ids = append(ids, id)
+		}
+	}
+	for _, revision := range transaction.FileContractRevisions {
+		ids = append(ids, revision.ParentId)
+	}
+	for _, storageProof := range transaction.StorageProofs {
+		ids = append(ids, storageProof.ParentId)
+	}
+	return uniqueStrings(ids)
+
+}
+
+func heightKey(height uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, height)
+	return key
+}
+
+func addressKeyPrefix(address string) []byte {
+	return append([]byte(address), '/')
+}
+
+//addressKey is the key of the address index entries: address/height/transaction id
+func addressKey(address string, height uint64, id string) []byte {
+	key := addressKeyPrefix(address)
+	key = append(key, heightKey(height)...)
+	return append(key, id...)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"scp-app-api/spdbridge"
+	"testing"
+)
+
+func TestAddressIndexApplyAndRevert(t *testing.T) {
+
+	index, err := openAddressIndex(filepath.Join(t.TempDir(), addressIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.db.Close()
+
+	//The input of the second transaction has empty unlock conditions
+	emptyAddress, _ := spdbridge.UnlockConditions{}.UnlockHash()
+	blocks := []*spdbridge.ConsensusBlock{
+		{Id: "block0", Height: 0, Timestamp: 100, Transactions: []spdbridge.ConsensusTransaction{
+			{Id: "tx0", RawTransaction: spdbridge.RawTransaction{ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: "a"}, {UnlockHash: "a"}}}},
+		}},
+		{Id: "block1", Height: 1, ParentId: "block0", Timestamp: 200, Transactions: []spdbridge.ConsensusTransaction{
+			{Id: "tx1", RawTransaction: spdbridge.RawTransaction{
+				ScpInputs:  []spdbridge.ScpInput{{ParentId: "x"}},
+				ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: "a"}, {UnlockHash: "b"}},
+			}},
+		}},
+	}
+	if err := index.applyBlocks(blocks); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := index.AddressesBatch(context.Background(), []string{"a", "b", "c", emptyAddress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Addresses) != 3 {
+		t.Fatalf("expected 3 addresses, got %v", len(resp.Addresses))
+	}
+	a := resp.Addresses[0]
+	if len(a.Transactions) != 2 || a.Transactions[0].Id != "tx0" || a.Transactions[1].Id != "tx1" {
+		t.Fatalf("unexpected transactions for address a: %+v", a.Transactions)
+	}
+	if a.Transactions[1].Height != 1 || a.Transactions[1].BlockTimestamp != 200 {
+		t.Fatalf("unexpected block data for tx1: %+v", a.Transactions[1])
+	}
+	if resp.Addresses[2].Address != emptyAddress || resp.Addresses[2].Transactions[0].Id != "tx1" {
+		t.Fatal("input address not indexed")
+	}
+
+	next, lastId, err := index.tip()
+	if err != nil || next != 2 || lastId != "block1" {
+		t.Fatalf("unexpected tip %v %v %v", next, lastId, err)
+	}
+
+	if err := index.revertBlock(1); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = index.AddressesBatch(context.Background(), []string{"a", "b", emptyAddress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Addresses) != 1 || len(resp.Addresses[0].Transactions) != 1 {
+		t.Fatalf("unexpected addresses after revert: %+v", resp.Addresses)
+	}
+	next, lastId, err = index.tip()
+	if err != nil || next != 1 || lastId != "block0" {
+		t.Fatalf("unexpected tip after revert %v %v %v", next, lastId, err)
+	}
+
+}
+
+func TestAddressIndexMinerPayouts(t *testing.T) {
+
+	index, err := openAddressIndex(filepath.Join(t.TempDir(), addressIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.db.Close()
+
+	blockId := "746b03349593d4710d1e8918c3b1212825cbfbdb3cd9923b0e7030648a6ccaa5"
+	blocks := []*spdbridge.ConsensusBlock{{Id: blockId, Height: 0, Timestamp: 100, MinerPayouts: []spdbridge.ScpOutput{
+		{Value: "1", UnlockHash: "miner"}, {Value: "2", UnlockHash: "fund"}, {Value: "3", UnlockHash: "miner"},
+	}}}
+	if err := index.applyBlocks(blocks); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := index.AddressesBatch(context.Background(), []string{"miner", "fund"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Addresses) != 2 || len(resp.Addresses[0].Blocks) != 1 || len(resp.Addresses[0].Transactions) != 0 {
+		t.Fatalf("unexpected addresses %+v", resp.Addresses)
+	}
+	block := resp.Addresses[0].Blocks[0]
+	if block.BlockId != blockId || block.RawBlock.Timestamp != 100 || len(block.RawBlock.MinerPayouts) != 3 ||
+		block.MinerPayoutIds[2] != "5a09dc41deda5e913310fdea31e3744be3029ee2c944366caeb60d56bf6c6281" {
+		t.Fatalf("unexpected block %+v", block)
+	}
+
+	if err := index.revertBlock(0); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = index.AddressesBatch(context.Background(), []string{"miner", "fund"})
+	if err != nil || len(resp.Addresses) != 0 {
+		t.Fatalf("unexpected addresses after revert: %+v %v", resp, err)
+	}
+
+}
+
+func TestAddressIndexCaughtUp(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), addressIndexFile)
+	index, err := openAddressIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := []*spdbridge.ConsensusBlock{{Id: "block0", Height: 0}, {Id: "block1", Height: 1, ParentId: "block0"}}
+	if err := index.applyBlocks(blocks); err != nil {
+		t.Fatal(err)
+	}
+	index.db.Close()
+
+	//The indexed height is read back when the index is opened again
+	index, err = openAddressIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.db.Close()
+	originalData := networkData
+	defer func() { networkData = originalData }()
+
+	for _, test := range []struct {
+		height   uint64
+		caughtUp bool
+	}{
+		{1, true},
+		{1 + addressIndexMaxLag, true},
+		{2 + addressIndexMaxLag, false},
+		{100000, false},
+	} {
+		networkData = &NetworkData{ConsensusHeight: test.height}
+		if index.caughtUp() != test.caughtUp {
+			t.Fatalf("expected the index at height 1 to be caught up %v at consensus height %v", test.caughtUp, test.height)
+		}
+	}
+
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/sync/singleflight"
+	"net/http"
+	"scp-app-api/spdbridge"
+	"strconv"
+	"sync"
+)
+
+const (
+	//blockCacheConfirmations is the depth from which cached blocks are considered final, the ones closer to the tip
+	//are only served from the cache until the current block changes
+	blockCacheConfirmations = 6
+	blockCacheSize          = 2000
+
+	recentBlocksDefault = 10
+	recentBlocksMax     = 50
+	blockLatest         = "latest"
+)
+
+type blockCacheEntry struct {
+	block BlockResp
+	//tip is the current block when the entry was fetched
+	tip string
+}
+
+var blockCache = struct {
+	sync.Mutex
+	byHeight map[uint64]blockCacheEntry
+	heights  map[string]uint64
+}{byHeight: make(map[uint64]blockCacheEntry), heights: make(map[string]uint64)}
+
+var blockRequests singleflight.Group
+
+var errBlockNotInChain = errors.New("block not in the main chain")
+
+//fetchConsensusBlock and fetchConsensusBlockById are the sources of the blocks cached
+var fetchConsensusBlock = spdbridge.GetConsensusBlock
+var fetchConsensusBlockById = spdbridge.GetConsensusBlockById
+
+//getBlockHandler handles requests to /blocks/:id
+//Returns the block with the id or at the height provided, or the current block when id is latest
+func getBlockHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	data, err := GetNetworkData()
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	var block *BlockResp
+	id := ps.ByName("id")
+	if id == blockLatest {
+		block, err = blockByHeight(data.ConsensusHeight, data)
+	} else if height, parseErr := strconv.ParseUint(id, 10, 64); parseErr == nil {
+		if height > data.ConsensusHeight {
+			http.Error(w, failResponse("unknown block"), 404)
+			return
+		}
+		block, err = blockByHeight(height, data)
+	} else {
+		if decoded, decodeErr := hex.DecodeString(id); decodeErr != nil || len(decoded) != 32 {
+			http.Error(w, failResponse("invalid block id"), 400)
+			return
+		}
+		block, err = blockById(id, data)
+	}
+	if spdbridge.IsBadRequest(err) || err == errBlockNotInChain {
+		http.Error(w, failResponse("unknown block"), 404)
+		return
+	} else if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	if block.Height <= data.ConsensusHeight {
+		block.Confirmations = data.ConsensusHeight - block.Height + 1
+	}
+	jsonResp, err := json.Marshal(block)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//getBlocksHandler handles requests to /blocks
+//Returns the latest blocks, the current one first. The count query parameter sets how many, up to recentBlocksMax
+func getBlocksHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	count := uint64(recentBlocksDefault)
+	if countParam := r.URL.Query().Get("count"); countParam != "" {
+		var err error
+		count, err = strconv.ParseUint(countParam, 10, 64)
+		if err != nil || count == 0 || count > recentBlocksMax {
+			http.Error(w, failResponse("invalid count"), 400)
+			return
+		}
+	}
+
+	data, err := GetNetworkData()
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	resp := BlocksResp{Height: data.ConsensusHeight, Blocks: []BlockResp{}}
+	for i := uint64(0); i < count && i <= data.ConsensusHeight; i++ {
+		block, err := blockByHeight(data.ConsensusHeight-i, data)
+		if err != nil {
+			http.Error(w, standardFailResponse, 500)
+			return
+		}
+		block.Confirmations = i + 1
+		resp.Blocks = append(resp.Blocks, *block)
+	}
+
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//blockByHeight returns the block at height from the cache or from spd, identical concurrent requests are coalesced
+//in a single spd call
+func blockByHeight(height uint64, data *NetworkData) (*BlockResp, error) {
+
+	if block := cachedBlock(height, "", data); block != nil {
+		return block, nil
+	}
+
+	result, err, _ := blockRequests.Do("height:"+strconv.FormatUint(height, 10), func() (interface{}, error) {
+		return fetchConsensusBlock(height)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cacheBlock(result.(*spdbridge.ConsensusBlock), data)
+
+}
+
+//blockById returns the block with the id provided from the cache or from spd, errBlockNotInChain if it isn't the block
+//at its height in the main chain
+func blockById(id string, data *NetworkData) (*BlockResp, error) {
+
+	blockCache.Lock()
+	height, ok := blockCache.heights[id]
+	blockCache.Unlock()
+	if ok {
+		if block := cachedBlock(height, id, data); block != nil {
+			return block, nil
+		}
+	}
+
+	result, err, _ := blockRequests.Do("id:"+id, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.Background(), batchRequestTimeout)
+		defer cancel()
+		return fetchConsensusBlockById(fetchCtx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//spd also returns the blocks removed from the main chain by a reorg, so the block is only returned, and cached,
+	//through its height once it's known to be the one there
+	height = result.(*spdbridge.ConsensusBlock).Height
+	if height > data.ConsensusHeight {
+		return nil, errBlockNotInChain
+	}
+	block, err := blockByHeight(height, data)
+	if err != nil {
+		return nil, err
+	}
+	if block.Id != id {
+		return nil, errBlockNotInChain
+	}
+	return block, nil
+
+}
+
+//cachedBlock returns a copy of the cached block at height, if it's still valid and has the id provided when not empty
+func cachedBlock(height uint64, id string, data *NetworkData) *BlockResp {
+
+	blockCache.Lock()
+	defer blockCache.Unlock()
+
+	entry, ok := blockCache.byHeight[height]
+	if !ok || (id != "" && entry.block.Id != id) {
+		return nil
+	}
+	if height+blockCacheConfirmations > data.ConsensusHeight && entry.tip != data.CurrentBlock {
+		return nil
+	}
+	block := entry.block
+	return &block
+
+}
+
+//cacheBlock converts the spd block and caches it, evicting the lowest block when the cache is full. Blocks lower than
+//all the cached ones aren't cached then
+func cacheBlock(consensusBlock *spdbridge.ConsensusBlock, data *NetworkData) (*BlockResp, error) {
+
+	block := BlockResp{
+		Id:             consensusBlock.Id,
+		Height:         consensusBlock.Height,
+		ParentId:       consensusBlock.ParentId,
+		Timestamp:      consensusBlock.Timestamp,
+		Difficulty:     consensusBlock.Difficulty,
+		MinerPayouts:   []BlockMinerPayout{},
+		TransactionIds: []string{},
+	}
+	for i, payout := range consensusBlock.MinerPayouts {
+		id, err := spdbridge.MinerPayoutId(consensusBlock.Id, uint64(i))
+		if err != nil {
+			return nil, err
+		}
+		block.MinerPayouts = append(block.MinerPayouts, BlockMinerPayout{
+			Id:             id,
+			Value:          payout.Value,
+			Address:        payout.UnlockHash,
+			MaturityHeight: consensusBlock.Height + maturityDelay,
+		})
+	}
+	for _, transaction := range consensusBlock.Transactions {
+		block.TransactionIds = append(block.TransactionIds, transaction.Id)
+	}
+
+	blockCache.Lock()
+	defer blockCache.Unlock()
+
+	//Blocks beyond the known tip can't be validated against it
+	if block.Height > data.ConsensusHeight {
+		copied := block
+		return &copied, nil
+	}
+	if _, ok := blockCache.byHeight[block.Height]; !ok && len(blockCache.byHeight) >= blockCacheSize {
+		lowest := block.Height
+		for height := range blockCache.byHeight {
+			if height < lowest {
+				lowest = height
+			}
+		}
+		if lowest == block.Height {
+			copied := block
+			return &copied, nil
+		}
+		delete(blockCache.heights, blockCache.byHeight[lowest].block.Id)
+		delete(blockCache.byHeight, lowest)
+	}
+	if previous, ok := blockCache.byHeight[block.Height]; ok {
+		delete(blockCache.heights, previous.block.Id)
+	}
+	blockCache.byHeight[block.Height] = blockCacheEntry{block: block, tip: data.CurrentBlock}
+	blockCache.heights[block.Id] = block.Height
+	copied := block
+	return &copied, nil
+
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http/httptest"
+	"scp-app-api/spdbridge"
+	"sync/atomic"
+	"testing"
+)
+
+//fakeBlocks replaces the spd block sources with a chain of blocks whose ids depend on the fork provided, the
+//returned counter tracks the calls made
+func fakeBlocks(t *testing.T, tip uint64, fork *string) *int32 {
+
+	var calls int32
+	blockId := func(height uint64) string {
+		return fmt.Sprintf("%s%063x", *fork, height)[:64]
+	}
+	block := func(height uint64) *spdbridge.ConsensusBlock {
+		return &spdbridge.ConsensusBlock{
+			Id:           blockId(height),
+			Height:       height,
+			Timestamp:    1000 + height,
+			Difficulty:   "100",
+			MinerPayouts: []spdbridge.ScpOutput{{Value: "10", UnlockHash: "miner"}},
+			Transactions: []spdbridge.ConsensusTransaction{{Id: fmt.Sprintf("tx%d", height)}},
+		}
+	}
+
+	originalByHeight, originalById := fetchConsensusBlock, fetchConsensusBlockById
+	fetchConsensusBlock = func(height uint64) (*spdbridge.ConsensusBlock, error) {
+		atomic.AddInt32(&calls, 1)
+		return block(height), nil
+	}
+	fetchConsensusBlockById = func(_ context.Context, id string) (*spdbridge.ConsensusBlock, error) {
+		atomic.AddInt32(&calls, 1)
+		for height := uint64(0); height <= tip; height++ {
+			if blockId(height) == id {
+				return block(height), nil
+			}
+		}
+		return nil, &spdbridge.RequestError{Path: "/consensus/blocks", StatusCode: 400}
+	}
+	originalData := networkData
+	t.Cleanup(func() {
+		fetchConsensusBlock, fetchConsensusBlockById = originalByHeight, originalById
+		networkData = originalData
+		blockCache.Lock()
+		blockCache.byHeight = make(map[uint64]blockCacheEntry)
+		blockCache.heights = make(map[string]uint64)
+		blockCache.Unlock()
+	})
+	return &calls
+
+}
+
+func TestBlocks(t *testing.T) {
+
+	fork := "a"
+	calls := fakeBlocks(t, 20, &fork)
+	networkData = &NetworkData{ConsensusHeight: 20, CurrentBlock: fmt.Sprintf("a%063x", 20)}
+
+	get := func(path string, id string) (int, []byte) {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", path, nil)
+		if id == "" {
+			getBlocksHandler(recorder, request, nil)
+		} else {
+			getBlockHandler(recorder, request, httprouter.Params{{Key: "id", Value: id}})
+		}
+		return recorder.Code, recorder.Body.Bytes()
+	}
+
+	statusCode, body := get("/v1/blocks/latest", "latest")
+	var latest BlockResp
+	json.Unmarshal(body, &latest)
+	if statusCode != 200 || latest.Height != 20 || latest.Confirmations != 1 || latest.Timestamp != 1020 || latest.Difficulty != "100" ||
+		len(latest.TransactionIds) != 1 || len(latest.MinerPayouts) != 1 || latest.MinerPayouts[0].MaturityHeight != 164 {
+		t.Fatalf("unexpected latest block %v %+v", statusCode, latest)
+	}
+
+	statusCode, body = get("/v1/blocks/10", "10")
+	var byHeight BlockResp
+	json.Unmarshal(body, &byHeight)
+	if statusCode != 200 || byHeight.Height != 10 || byHeight.Confirmations != 11 {
+		t.Fatalf("unexpected block %v %+v", statusCode, byHeight)
+	}
+	statusCode, body = get("/v1/blocks/"+byHeight.Id, byHeight.Id)
+	var byId BlockResp
+	json.Unmarshal(body, &byId)
+	if statusCode != 200 || byId.Id != byHeight.Id || atomic.LoadInt32(calls) != 2 {
+		t.Fatalf("expected the block from the cache, got %v %+v after %v calls", statusCode, byId, *calls)
+	}
+
+	statusCode, body = get("/v1/blocks?count=5", "")
+	var recent BlocksResp
+	json.Unmarshal(body, &recent)
+	if statusCode != 200 || len(recent.Blocks) != 5 || recent.Blocks[0].Height != 20 || recent.Blocks[4].Height != 16 || recent.Blocks[4].Confirmations != 5 {
+		t.Fatalf("unexpected recent blocks %v %+v", statusCode, recent)
+	}
+	if atomic.LoadInt32(calls) != 6 {
+		t.Fatalf("expected the latest block from the cache, got %v calls", *calls)
+	}
+
+	//A reorg replacing the tip invalidates the blocks close to it, the deeper ones are still served from the cache
+	fork = "b"
+	networkData = &NetworkData{ConsensusHeight: 20, CurrentBlock: fmt.Sprintf("b%063x", 20)}
+	get("/v1/blocks/10", "10")
+	statusCode, body = get("/v1/blocks/latest", "latest")
+	json.Unmarshal(body, &latest)
+	if statusCode != 200 || latest.Id != networkData.CurrentBlock || atomic.LoadInt32(calls) != 7 {
+		t.Fatalf("expected the new tip, got %v %+v after %v calls", statusCode, latest, *calls)
+	}
+
+	for _, test := range []struct {
+		id         string
+		statusCode int
+	}{
+		{"21", 404},
+		{"notanid", 400},
+		{fmt.Sprintf("%064x", 99), 404},
+	} {
+		if statusCode, _ := get("/v1/blocks/"+test.id, test.id); statusCode != test.statusCode {
+			t.Fatalf("expected status %v for %v, got %v", test.statusCode, test.id, statusCode)
+		}
+	}
+	if statusCode, _ := get("/v1/blocks?count=51", ""); statusCode != 400 {
+		t.Fatalf("expected status 400, got %v", statusCode)
+	}
+
+}
+
+func TestOrphanedBlock(t *testing.T) {
+
+	fork := "a"
+	fakeBlocks(t, 20, &fork)
+	networkData = &NetworkData{ConsensusHeight: 20, CurrentBlock: fmt.Sprintf("a%063x", 20)}
+
+	//spd still knows the block a reorg removed from the main chain at height 10
+	orphanedId := fmt.Sprintf("b%063x", 10)
+	fetchConsensusBlockById = func(_ context.Context, id string) (*spdbridge.ConsensusBlock, error) {
+		return &spdbridge.ConsensusBlock{Id: id, Height: 10, Timestamp: 5000}, nil
+	}
+
+	recorder := httptest.NewRecorder()
+	getBlockHandler(recorder, httptest.NewRequest("GET", "/v1/blocks/"+orphanedId, nil), httprouter.Params{{Key: "id", Value: orphanedId}})
+	if recorder.Code != 404 {
+		t.Fatalf("expected the orphaned block to be unknown, got %v %v", recorder.Code, recorder.Body.String())
+	}
+	block, err := blockByHeight(10, networkData)
+	if err != nil || block.Id != fmt.Sprintf("a%063x", 10) {
+		t.Fatalf("expected the main chain block at height 10, got %v %+v", err, block)
+	}
+
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"scp-app-api/spdbridge"
+	"sync"
+	"time"
+)
+
+const broadcastsFile = "broadcasts.json"
+
+const (
+	broadcastCheckInterval = 2 * time.Minute
+	//broadcastMaxAge is how long a transaction set is rebroadcast before giving up on it
+	broadcastMaxAge = 72 * time.Hour
+	//broadcastRetention is how long the tracking state of finished transaction sets is kept
+	broadcastRetention = 7 * 24 * time.Hour
+)
+
+const (
+	broadcastPending   = "pending"
+	broadcastDropped   = "dropped"
+	broadcastConfirmed = "confirmed"
+	broadcastInvalid   = "invalid"
+	broadcastExpired   = "expired"
+)
+
+//trackedBroadcast is a transaction set broadcast through the API, kept until it's confirmed or it can't be
+//broadcast anymore. Tracked broadcasts are persisted in broadcastsFile
+type trackedBroadcast struct {
+	Id            string   `json:"id"`
+	ParentIds     []string `json:"parentIds"`
+	Parents       string   `json:"parents"`
+	Transaction   string   `json:"transaction"`
+	Status        string   `json:"status"`
+	BroadcastAt   int64    `json:"broadcastAt"`
+	LastCheckedAt int64    `json:"lastCheckedAt"`
+	FinishedAt    int64    `json:"finishedAt,omitempty"`
+	Rebroadcasts  int      `json:"rebroadcasts"`
+	LastError     string   `json:"lastError,omitempty"`
+}
+
+var broadcasts = struct {
+	sync.Mutex
+	broadcasts map[string]*trackedBroadcast
+}{broadcasts: make(map[string]*trackedBroadcast)}
+
+//StartBroadcastTracker loads the tracked broadcasts and starts checking them
+func StartBroadcastTracker() {
+
+	var stored map[string]*trackedBroadcast
+	err := loadJSON(broadcastsFile, &stored)
+	if err != nil {
+		fmt.Printf("Error while loading tracked broadcasts: %v\n", err)
+	}
+	broadcasts.Lock()
+	for id, broadcast := range stored {
+		broadcasts.broadcasts[id] = broadcast
+	}
+	broadcasts.Unlock()
+
+	go syncBroadcasts()
+
+}
+
+func syncBroadcasts() {
+
+	checkBroadcasts()
+
+	time.Sleep(broadcastCheckInterval)
+	go syncBroadcasts()
+
+}
+
+//trackBroadcast starts tracking a transaction set accepted by spd, returns the id of its last transaction
+func trackBroadcast(parents string, transaction string) (string, error) {
+
+	parentTransactions, err := spdbridge.ParseTransactions(parents)
+	if err != nil {
+		return "", err
+	}
+	lastTransaction, err := spdbridge.ParseTransaction(transaction)
+	if err != nil {
+		return "", err
+	}
+	id, err := lastTransaction.Id()
+	if err != nil {
+		return "", err
+	}
+	var parentIds []string
+	for i := range parentTransactions {
+		parentId, err := parentTransactions[i].Id()
+		if err != nil {
+			return "", err
+		}
+		parentIds = append(parentIds, parentId)
+	}
+
+	now := time.Now().Unix()
+	broadcasts.Lock()
+	defer broadcasts.Unlock()
+	if _, ok := broadcasts.broadcasts[id]; !ok {
+		broadcasts.broadcasts[id] = &trackedBroadcast{
+			Id:            id,
+			ParentIds:     parentIds,
+			Parents:       parents,
+			Transaction:   transaction,
+			Status:        broadcastPending,
+			BroadcastAt:   now,
+			LastCheckedAt: now,
+		}
+	}
+	return id, saveBroadcasts()
+
+}
+
+//getBroadcastHandler handles requests to /broadcasts/:id
+//Returns the tracking state of a transaction set broadcast through the API, by the id of its last transaction
+func getBroadcastHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	broadcasts.Lock()
+	broadcast, ok := broadcasts.broadcasts[ps.ByName("id")]
+	var resp BroadcastResp
+	if ok {
+		resp = broadcast.response()
+	}
+	broadcasts.Unlock()
+	if !ok {
+		http.Error(w, standardFailResponse, 404)
+		return
+	}
+
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//checkBroadcasts checks whether the tracked transaction sets are still in the pool or confirmed,
+//rebroadcasting the dropped ones
+func checkBroadcasts() {
+
+	//The broadcasts are checked on copies, so that the lock isn't held during the spd requests
+	broadcasts.Lock()
+	var entries []*trackedBroadcast
+	var tracked []trackedBroadcast
+	for id, broadcast := range broadcasts.broadcasts {
+		if broadcast.FinishedAt != 0 {
+			if time.Since(time.Unix(broadcast.FinishedAt, 0)) > broadcastRetention {
+				delete(broadcasts.broadcasts, id)
+			}
+			continue
+		}
+		entries = append(entries, broadcast)
+		tracked = append(tracked, *broadcast)
+	}
+	broadcasts.Unlock()
+
+	for i := range tracked {
+		checked := &tracked[i]
+		checkBroadcast(checked)
+		//The entry is read again under the lock, it's only updated if it's still the one which has been checked
+		broadcasts.Lock()
+		if current, ok := broadcasts.broadcasts[checked.Id]; ok && current == entries[i] {
+			current.updateState(checked)
+		}
+		broadcasts.Unlock()
+	}
+
+	broadcasts.Lock()
+	err := saveBroadcasts()
+	broadcasts.Unlock()
+	if err != nil {
+		fmt.Printf("Error while saving tracked broadcasts: %v\n", err)
+	}
+
+}
+
+//updateState copies the state resulting from a check of the broadcast, leaving the transaction set untouched
+func (broadcast *trackedBroadcast) updateState(checked *trackedBroadcast) {
+	broadcast.Status = checked.Status
+	broadcast.LastCheckedAt = checked.LastCheckedAt
+	broadcast.FinishedAt = checked.FinishedAt
+	broadcast.Rebroadcasts = checked.Rebroadcasts
+	broadcast.LastError = checked.LastError
+}
+
+//checkBroadcast updates the state of the broadcast, rebroadcasting it if it has been dropped from the pool
+func checkBroadcast(broadcast *trackedBroadcast) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), batchRequestTimeout)
+	defer cancel()
+
+	now := time.Now()
+	broadcast.LastCheckedAt = now.Unix()
+
+	confirmed, err := spdbridge.TransactionPoolConfirmed(ctx, broadcast.Id)
+	if err != nil {
+		broadcast.LastError = err.Error()
+		return
+	}
+	if confirmed {
+		broadcast.Status = broadcastConfirmed
+		broadcast.FinishedAt = now.Unix()
+		return
+	}
+	pending, err := spdbridge.GetTransactionPoolRaw(ctx, broadcast.Id)
+	if err != nil {
+		broadcast.LastError = err.Error()
+		return
+	}
+	if pending != nil {
+		broadcast.Status = broadcastPending
+		return
+	}
+
+	if now.Sub(time.Unix(broadcast.BroadcastAt, 0)) > broadcastMaxAge {
+		broadcast.Status = broadcastExpired
+		broadcast.FinishedAt = now.Unix()
+		return
+	}
+
+	broadcast.Status = broadcastDropped
+	parents, err := unconfirmedParents(ctx, broadcast)
+	if err != nil {
+		broadcast.LastError = err.Error()
+		return
+	}
+	_, err = spdbridge.TransactionPoolRaw(parents, broadcast.Transaction)
+	if spdbridge.IsBadRequest(err) {
+		//spd doesn't accept the set anymore, for example because its inputs have been spent by another transaction
+		broadcast.Status = broadcastInvalid
+		broadcast.LastError = err.Error()
+		broadcast.FinishedAt = now.Unix()
+		return
+	} else if err != nil {
+		broadcast.LastError = err.Error()
+		return
+	}
+	broadcast.Rebroadcasts++
+	broadcast.Status = broadcastPending
+	broadcast.LastError = ""
+
+}
+
+//unconfirmedParents returns the parents of the broadcast which are not confirmed yet, ready to be rebroadcast
+func unconfirmedParents(ctx context.Context, broadcast *trackedBroadcast) (string, error) {
+
+	parents, err := spdbridge.ParseTransactions(broadcast.Parents)
+	if err != nil {
+		return "", err
+	}
+
+	var unconfirmed []spdbridge.Transaction
+	for i, parentId := range broadcast.ParentIds {
+		confirmed, err := spdbridge.TransactionPoolConfirmed(ctx, parentId)
+		if err != nil {
+			return "", err
+		}
+		if !confirmed {
+			unconfirmed = append(unconfirmed, parents[i])
+		}
+	}
+	if len(unconfirmed) == len(parents) {
+		return broadcast.Parents, nil
+	}
+
+	encoded, err := spdbridge.EncodeTransactions(unconfirmed)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encoded), nil
+
+}
+
+//response returns the tracking state as exposed by the API, without the transaction data
+func (broadcast *trackedBroadcast) response() BroadcastResp {
+	return BroadcastResp{
+		Id:            broadcast.Id,
+		ParentIds:     broadcast.ParentIds,
+		Status:        broadcast.Status,
+		BroadcastAt:   broadcast.BroadcastAt,
+		LastCheckedAt: broadcast.LastCheckedAt,
+		Rebroadcasts:  broadcast.Rebroadcasts,
+		LastError:     broadcast.LastError,
+	}
+}
+
+//saveBroadcasts persists the tracked broadcasts, must be called holding the broadcasts lock
+func saveBroadcasts() error {
+	return saveJSON(broadcastsFile, broadcasts.broadcasts)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"scp-app-api/spdbridge"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func encodeTestTransactions(t *testing.T, transactions ...spdbridge.Transaction) string {
+	encoded, err := spdbridge.EncodeTransactions(transactions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(encoded)
+}
+
+func TestBroadcastRebroadcast(t *testing.T) {
+
+	dataDir = t.TempDir()
+
+	parent := spdbridge.Transaction{ArbitraryData: [][]byte{[]byte("parent")}}
+	transaction := spdbridge.Transaction{ArbitraryData: [][]byte{[]byte("transaction")}}
+	parentId, _ := parent.Id()
+	rejected := spdbridge.Transaction{ArbitraryData: [][]byte{[]byte("rejected")}}
+	transactionJSON, _ := json.Marshal(transaction)
+	rejectedJSON, _ := json.Marshal(rejected)
+
+	var mutex sync.Mutex
+	var rebroadcasts []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tpool/confirmed/", func(w http.ResponseWriter, r *http.Request) {
+		//The parent got confirmed, while the transaction was dropped from the pool
+		confirmed := strings.TrimPrefix(r.URL.Path, "/tpool/confirmed/") == parentId
+		json.NewEncoder(w).Encode(spdbridge.TransactionPoolConfirmedResp{Confirmed: confirmed})
+	})
+	mux.HandleFunc("/tpool/raw/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "transaction not found in transaction pool", 400)
+	})
+	mux.HandleFunc("/tpool/raw", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("transaction") == string(rejectedJSON) {
+			http.Error(w, "error accepting transaction set", 400)
+			return
+		}
+		mutex.Lock()
+		rebroadcasts = append(rebroadcasts, r.FormValue("parents"))
+		mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	fakeSpd(t, mux)
+
+	id, err := trackBroadcast(encodeTestTransactions(t, parent), string(transactionJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, _ := transaction.Id(); id != expected {
+		t.Fatalf("expected id %v, got %v", expected, id)
+	}
+	rejectedId, err := trackBroadcast("[]", string(rejectedJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkBroadcasts()
+
+	mutex.Lock()
+	if len(rebroadcasts) != 1 || rebroadcasts[0] != encodeTestTransactions(t) {
+		t.Fatalf("expected the transaction to be rebroadcast without its confirmed parent, got %v", rebroadcasts)
+	}
+	mutex.Unlock()
+
+	broadcasts.Lock()
+	defer broadcasts.Unlock()
+	if broadcast := broadcasts.broadcasts[id]; broadcast.Status != broadcastPending || broadcast.Rebroadcasts != 1 {
+		t.Fatalf("unexpected tracking state %+v", broadcast)
+	}
+	if broadcast := broadcasts.broadcasts[rejectedId]; broadcast.Status != broadcastInvalid || broadcast.FinishedAt == 0 {
+		t.Fatalf("unexpected tracking state %+v", broadcast)
+	}
+
+}
+
+func TestBroadcastReplacedDuringCheck(t *testing.T) {
+
+	dataDir = t.TempDir()
+	broadcasts.Lock()
+	broadcasts.broadcasts = make(map[string]*trackedBroadcast)
+	broadcasts.Unlock()
+
+	transaction := spdbridge.Transaction{ArbitraryData: [][]byte{[]byte("replaced")}}
+	transactionJSON, _ := json.Marshal(transaction)
+	replacement := &trackedBroadcast{Status: broadcastPending, BroadcastAt: 1}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tpool/confirmed/", func(w http.ResponseWriter, r *http.Request) {
+		//The broadcast expires and is tracked again while it's being checked
+		broadcasts.Lock()
+		replacement.Id = strings.TrimPrefix(r.URL.Path, "/tpool/confirmed/")
+		broadcasts.broadcasts[replacement.Id] = replacement
+		broadcasts.Unlock()
+		json.NewEncoder(w).Encode(spdbridge.TransactionPoolConfirmedResp{Confirmed: true})
+	})
+	fakeSpd(t, mux)
+
+	id, err := trackBroadcast("[]", string(transactionJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBroadcasts()
+
+	broadcasts.Lock()
+	defer broadcasts.Unlock()
+	if broadcast := broadcasts.broadcasts[id]; broadcast != replacement || broadcast.Status != broadcastPending || broadcast.FinishedAt != 0 {
+		t.Fatalf("expected the replacement to be left untouched, got %+v", broadcast)
+	}
+
+}
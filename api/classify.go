@@ -0,0 +1,60 @@
+package main
+
+import (
+	"scp-app-api/spdbridge"
+)
+
+const (
+	transactionTransfer          = "transfer"
+	transactionSelfTransfer      = "selfTransfer"
+	transactionContractFormation = "contractFormation"
+	transactionContractRevision  = "contractRevision"
+	transactionStorageProof      = "storageProof"
+	transactionSpfTransfer       = "spfTransfer"
+	transactionArbitraryData     = "arbitraryData"
+	//transactionMinerPayout and the contract payouts are the types of the delayed outputs returned along with the
+	//transactions, see delayedOutputs. They aren't transactions on chain, so classifyTransaction never returns them
+	transactionMinerPayout        = "minerPayout"
+	transactionStorageProofPayout = "storageProofPayout"
+	transactionMissedProofPayout  = "missedProofPayout"
+)
+
+//classifyTransaction returns the type of the transaction based on its contents. Host transactions are checked first
+//since they also carry SCP inputs and outputs: storage proofs, contract revisions, then file contracts. Transactions
+//moving SPF come next, then transactions without any SCP input or output, which only carry arbitrary data such as
+//host announcements. The remaining transactions are self transfers when every SCP output goes back to the addresses
+//spending the inputs, ordinary transfers otherwise
+func classifyTransaction(transaction spdbridge.RawTransaction) string {
+
+	switch {
+	case len(transaction.StorageProofs) > 0:
+		return transactionStorageProof
+	case len(transaction.FileContractRevisions) > 0:
+		return transactionContractRevision
+	case len(transaction.FileContracts) > 0:
+		return transactionContractFormation
+	case len(transaction.SpfInputs) > 0 || len(transaction.SpfOutputs) > 0:
+		return transactionSpfTransfer
+	case len(transaction.ScpInputs) == 0 && len(transaction.ScpOutputs) == 0:
+		return transactionArbitraryData
+	}
+
+	if len(transaction.ScpInputs) == 0 {
+		return transactionTransfer
+	}
+	inputAddresses := make(map[string]struct{})
+	for _, input := range transaction.ScpInputs {
+		address, err := input.UnlockConditions.UnlockHash()
+		if err != nil {
+			return transactionTransfer
+		}
+		inputAddresses[address] = struct{}{}
+	}
+	for _, output := range transaction.ScpOutputs {
+		if _, ok := inputAddresses[output.UnlockHash]; !ok {
+			return transactionTransfer
+		}
+	}
+	return transactionSelfTransfer
+
+}
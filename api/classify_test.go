@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"scp-app-api/spdbridge"
+	"testing"
+)
+
+func TestClassifyTransaction(t *testing.T) {
+
+	unlockConditions := spdbridge.UnlockConditions{
+		SignaturesRequired: 1,
+		PublicKeys:         []spdbridge.ScpPublicKey{{Algorithm: "ed25519", Key: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}},
+	}
+	address, err := unlockConditions.UnlockHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := []spdbridge.ScpInput{{ParentId: "parent", UnlockConditions: unlockConditions}}
+
+	var fixture spdbridge.RawTransaction
+	data, err := ioutil.ReadFile("../spdbridge/testdata/transaction.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		transaction spdbridge.RawTransaction
+		expected    string
+	}{
+		{"fixture", fixture, transactionStorageProof},
+		{"payment", spdbridge.RawTransaction{
+			ScpInputs:  inputs,
+			ScpOutputs: []spdbridge.ScpOutput{{Value: "1", UnlockHash: "recipient"}, {Value: "2", UnlockHash: address}},
+		}, transactionTransfer},
+		{"self transfer", spdbridge.RawTransaction{
+			ScpInputs:  inputs,
+			ScpOutputs: []spdbridge.ScpOutput{{Value: "1", UnlockHash: address}},
+		}, transactionSelfTransfer},
+		{"invalid unlock conditions", spdbridge.RawTransaction{
+			ScpInputs:  []spdbridge.ScpInput{{UnlockConditions: spdbridge.UnlockConditions{PublicKeys: []spdbridge.ScpPublicKey{{Key: "not base64"}}}}},
+			ScpOutputs: []spdbridge.ScpOutput{{Value: "1", UnlockHash: address}},
+		}, transactionTransfer},
+		{"contract formation", spdbridge.RawTransaction{
+			ScpInputs:     inputs,
+			ScpOutputs:    []spdbridge.ScpOutput{{Value: "1", UnlockHash: address}},
+			FileContracts: fixture.FileContracts,
+		}, transactionContractFormation},
+		{"contract revision", spdbridge.RawTransaction{
+			FileContractRevisions: []spdbridge.FileContractRevision{{ParentId: "contract"}},
+		}, transactionContractRevision},
+		{"storage proof", spdbridge.RawTransaction{StorageProofs: fixture.StorageProofs}, transactionStorageProof},
+		{"spf transfer", spdbridge.RawTransaction{
+			ScpInputs:  inputs,
+			SpfInputs:  []spdbridge.SpfInput{{ParentId: "spf", UnlockConditions: unlockConditions, ClaimUnlockHash: address}},
+			SpfOutputs: []spdbridge.SpfOutput{{Value: "10", UnlockHash: "recipient"}},
+			MinerFees:  []string{"1"},
+		}, transactionSpfTransfer},
+		//Block rewards aren't transactions, SCP created without inputs is only found in the genesis block
+		{"genesis allocation", spdbridge.RawTransaction{ScpOutputs: []spdbridge.ScpOutput{{Value: "1", UnlockHash: address}}}, transactionTransfer},
+		{"arbitrary data", spdbridge.RawTransaction{ArbitraryData: [][]byte{[]byte("data")}}, transactionArbitraryData},
+	}
+
+	for _, test := range tests {
+		if classified := classifyTransaction(test.transaction); classified != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, classified)
+		}
+	}
+
+	if transaction := newTransactionFromUnconfirmed(fixture).forVersion(1); transaction.Type != transactionStorageProof {
+		t.Fatalf("expected the type in v1 transactions, got %+v", transaction)
+	}
+
+}
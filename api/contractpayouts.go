@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"scp-app-api/spdbridge"
+	"sync"
+)
+
+const (
+	//contractFetchConcurrency is the number of contracts whose transactions are requested to spd at a time
+	contractFetchConcurrency = 8
+	contractPayoutsCacheSize = 100000
+)
+
+//fetchContractTransactions is the source of the transactions of a file contract: its formation, its revisions and
+//its storage proof
+var fetchContractTransactions = explorerContractTransactions
+
+//contractPayoutsCache holds the payouts of the contracts paid out at least blockCacheConfirmations blocks ago, which
+//aren't expected to change anymore
+var contractPayoutsCache = struct {
+	sync.Mutex
+	payouts map[string]spdbridge.ExplorerContractPayout
+}{payouts: make(map[string]spdbridge.ExplorerContractPayout)}
+
+//explorerContractTransactions returns the transactions of the file contract known by the spd explorer
+func explorerContractTransactions(ctx context.Context, contractId string) ([]spdbridge.ExplorerTransaction, error) {
+
+	resp, err := spdbridge.ExplorerHash(ctx, contractId)
+	if spdbridge.IsBadRequest(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if resp.HashType != "filecontractid" {
+		return nil, nil
+	}
+	return resp.Transactions, nil
+
+}
+
+//addContractPayouts sets the payouts of the file contracts found in the transactions of each address, when they pay
+//the address. Only the contracts whose proof window has started can have paid out, so only their transactions are
+//fetched to look for the storage proof
+func addContractPayouts(ctx context.Context, resp *spdbridge.AddressesBatchResp) error {
+
+	paying := make([][]string, len(resp.Addresses))
+	windowStarts := make(map[string]uint64)
+	for i, explorerAddress := range resp.Addresses {
+		for _, explorerTransaction := range explorerAddress.Transactions {
+			for id, windowStart := range contractsPaying(explorerTransaction.RawTransaction, explorerAddress.Address) {
+				if known, ok := windowStarts[id]; !ok || windowStart < known {
+					windowStarts[id] = windowStart
+				}
+				paying[i] = append(paying[i], id)
+			}
+		}
+	}
+	if len(windowStarts) == 0 {
+		return nil
+	}
+
+	data, err := GetNetworkData()
+	if err != nil {
+		return err
+	}
+
+	var mutex sync.Mutex
+	payouts := make(map[string]*spdbridge.ExplorerContractPayout)
+	var firstErr error
+	semaphore := make(chan struct{}, contractFetchConcurrency)
+	var wg sync.WaitGroup
+	for id, windowStart := range windowStarts {
+		if windowStart > data.ConsensusHeight {
+			continue
+		}
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			payout, err := contractPayout(ctx, id, data)
+			mutex.Lock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			payouts[id] = payout
+			mutex.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	for i := range resp.Addresses {
+		var addressPayouts []spdbridge.ExplorerContractPayout
+		for _, id := range uniqueStrings(paying[i]) {
+			payout := payouts[id]
+			if payout == nil {
+				continue
+			}
+			for _, output := range payout.Outputs {
+				if output.UnlockHash == resp.Addresses[i].Address {
+					addressPayouts = append(addressPayouts, *payout)
+					break
+				}
+			}
+		}
+		resp.Addresses[i].ContractPayouts = addressPayouts
+	}
+	return nil
+
+}
+
+//contractsPaying returns the ids of the file contracts formed or revised by the transaction with a valid or missed
+//proof output to the address, along with their window start
+func contractsPaying(rawTransaction spdbridge.RawTransaction, address string) map[string]uint64 {
+
+	pays := func(outputs ...[]spdbridge.ScpOutput) bool {
+		for _, list := range outputs {
+			for _, output := range list {
+				if output.UnlockHash == address {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	contracts := make(map[string]uint64)
+	transaction := spdbridge.Transaction(rawTransaction)
+	for i, contract := range transaction.FileContracts {
+		if !pays(contract.ValidProofOutputs, contract.MissedProofOutputs) {
+			continue
+		}
+		id, err := transaction.FileContractId(uint64(i))
+		if err != nil {
+			continue
+		}
+		contracts[id] = contract.WindowStart
+	}
+	for _, revision := range transaction.FileContractRevisions {
+		if pays(revision.NewValidProofOutputs, revision.NewMissedProofOutputs) {
+			contracts[revision.ParentId] = revision.NewWindowStart
+		}
+	}
+	return contracts
+
+}
+
+//contractPayout returns the payout of the file contract at the current consensus height: its valid proof outputs if
+//a storage proof has been confirmed, its missed proof outputs if its window has ended without one, nil otherwise
+func contractPayout(ctx context.Context, contractId string, data *NetworkData) (*spdbridge.ExplorerContractPayout, error) {
+
+	contractPayoutsCache.Lock()
+	cached, ok := contractPayoutsCache.payouts[contractId]
+	contractPayoutsCache.Unlock()
+	if ok {
+		return &cached, nil
+	}
+
+	transactions, err := fetchContractTransactions(ctx, contractId)
+	if err != nil {
+		return nil, err
+	}
+
+	//The contract is formed first, then each revision with a higher number replaces its outputs and window
+	var contract *spdbridge.FileContract
+	var proof *spdbridge.ExplorerTransaction
+	for i, explorerTransaction := range transactions {
+		transaction := spdbridge.Transaction(explorerTransaction.RawTransaction)
+		for j, fileContract := range transaction.FileContracts {
+			if id, err := transaction.FileContractId(uint64(j)); err == nil && id == contractId {
+				formed := fileContract
+				contract = &formed
+			}
+		}
+		for _, storageProof := range transaction.StorageProofs {
+			if storageProof.ParentId == contractId {
+				proof = &transactions[i]
+			}
+		}
+	}
+	if contract == nil {
+		return nil, nil
+	}
+	for _, explorerTransaction := range transactions {
+		for _, revision := range explorerTransaction.RawTransaction.FileContractRevisions {
+			if revision.ParentId != contractId || revision.NewRevisionNumber <= contract.RevisionNumber {
+				continue
+			}
+			contract.RevisionNumber = revision.NewRevisionNumber
+			contract.WindowStart = revision.NewWindowStart
+			contract.WindowEnd = revision.NewWindowEnd
+			contract.ValidProofOutputs = revision.NewValidProofOutputs
+			contract.MissedProofOutputs = revision.NewMissedProofOutputs
+		}
+	}
+
+	payout := spdbridge.ExplorerContractPayout{ContractId: contractId}
+	if proof != nil {
+		payout.ValidProof = true
+		payout.Height = proof.Height
+		payout.Timestamp = proof.BlockTimestamp
+		payout.Outputs = contract.ValidProofOutputs
+	} else if data.ConsensusHeight >= contract.WindowEnd {
+		//The missed proof outputs are created by the block at the end of the window
+		block, err := blockByHeight(contract.WindowEnd, data)
+		if err != nil {
+			return nil, err
+		}
+		payout.Height = contract.WindowEnd
+		payout.Timestamp = block.Timestamp
+		payout.Outputs = contract.MissedProofOutputs
+	} else {
+		return nil, nil
+	}
+	for i := range payout.Outputs {
+		id, err := spdbridge.StorageProofOutputId(contractId, payout.ValidProof, uint64(i))
+		if err != nil {
+			return nil, err
+		}
+		payout.OutputIds = append(payout.OutputIds, id)
+	}
+
+	if payout.Height+blockCacheConfirmations <= data.ConsensusHeight {
+		contractPayoutsCache.Lock()
+		if len(contractPayoutsCache.payouts) >= contractPayoutsCacheSize {
+			contractPayoutsCache.payouts = make(map[string]spdbridge.ExplorerContractPayout)
+		}
+		contractPayoutsCache.payouts[contractId] = payout
+		contractPayoutsCache.Unlock()
+	}
+	return &payout, nil
+
+}
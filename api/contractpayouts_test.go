@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"scp-app-api/spdbridge"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestContractPayouts(t *testing.T) {
+
+	fork := "a"
+	fakeBlocks(t, 300, &fork)
+	networkData = &NetworkData{ConsensusHeight: 300, CurrentBlock: fmt.Sprintf("a%063x", 300)}
+	defer func() {
+		contractPayoutsCache.Lock()
+		contractPayoutsCache.payouts = make(map[string]spdbridge.ExplorerContractPayout)
+		contractPayoutsCache.Unlock()
+	}()
+
+	renter := testAddress
+	host := "49cdb96d5a413755809cbb6027713c8bad8aaf02df48d2284978c012bf720dcced457a9a1177"
+	formation := func(windowStart uint64, windowEnd uint64, height uint64) (spdbridge.ExplorerTransaction, string) {
+		transaction := spdbridge.RawTransaction{FileContracts: []spdbridge.FileContract{{
+			FileMerkleRoot:     strings.Repeat("0", 64),
+			WindowStart:        windowStart,
+			WindowEnd:          windowEnd,
+			Payout:             "100",
+			ValidProofOutputs:  []spdbridge.ScpOutput{{Value: "60", UnlockHash: renter}, {Value: "40", UnlockHash: host}},
+			MissedProofOutputs: []spdbridge.ScpOutput{{Value: "60", UnlockHash: renter}},
+			UnlockHash:         renter,
+		}}}
+		id, _ := (*spdbridge.Transaction)(&transaction).FileContractId(0)
+		return spdbridge.ExplorerTransaction{RawTransaction: transaction, Id: "formation" + id, Height: height}, id
+	}
+	proven, provenId := formation(100, 120, 10)
+	missed, missedId := formation(150, 170, 20)
+	open, openId := formation(290, 310, 30)
+	future, futureId := formation(400, 420, 40)
+	revision := spdbridge.ExplorerTransaction{Id: "revision", Height: 50, RawTransaction: spdbridge.RawTransaction{
+		FileContractRevisions: []spdbridge.FileContractRevision{{
+			ParentId:              provenId,
+			NewRevisionNumber:     1,
+			NewWindowStart:        100,
+			NewWindowEnd:          120,
+			NewValidProofOutputs:  []spdbridge.ScpOutput{{Value: "50", UnlockHash: renter}, {Value: "50", UnlockHash: host}},
+			NewMissedProofOutputs: []spdbridge.ScpOutput{{Value: "50", UnlockHash: renter}},
+		}},
+	}}
+	proof := spdbridge.ExplorerTransaction{Id: "proof", Height: 110, BlockTimestamp: 5000, RawTransaction: spdbridge.RawTransaction{
+		StorageProofs: []spdbridge.StorageProof{{ParentId: provenId}},
+	}}
+
+	histories := map[string][]spdbridge.ExplorerTransaction{
+		//The explorer doesn't return the transactions in chronological order
+		provenId: {proof, revision, proven},
+		missedId: {missed},
+		openId:   {open},
+		futureId: {future},
+	}
+	//The contracts are fetched concurrently
+	var mutex sync.Mutex
+	fetched := make(map[string]int)
+	originalFetch := fetchContractTransactions
+	fetchContractTransactions = func(_ context.Context, contractId string) ([]spdbridge.ExplorerTransaction, error) {
+		mutex.Lock()
+		fetched[contractId]++
+		mutex.Unlock()
+		return histories[contractId], nil
+	}
+	defer func() {
+		fetchContractTransactions = originalFetch
+	}()
+
+	explorerAddresses := func() *spdbridge.AddressesBatchResp {
+		return &spdbridge.AddressesBatchResp{Addresses: []spdbridge.ExplorerAddress{
+			{Address: renter, Transactions: []spdbridge.ExplorerTransaction{proven, missed, open, future, revision}},
+			{Address: host, Transactions: []spdbridge.ExplorerTransaction{proven, missed}},
+		}}
+	}
+	resp := explorerAddresses()
+	if err := addContractPayouts(context.Background(), resp); err != nil {
+		t.Fatal(err)
+	}
+	if fetched[futureId] != 0 || fetched[openId] != 1 {
+		t.Fatalf("expected only the contracts whose window has started to be fetched, got %v", fetched)
+	}
+
+	renterPayouts, hostPayouts := resp.Addresses[0].ContractPayouts, resp.Addresses[1].ContractPayouts
+	if len(renterPayouts) != 2 || len(hostPayouts) != 1 {
+		t.Fatalf("unexpected payouts %+v %+v", renterPayouts, hostPayouts)
+	}
+	byContract := make(map[string]spdbridge.ExplorerContractPayout)
+	for _, payout := range renterPayouts {
+		byContract[payout.ContractId] = payout
+	}
+	validId, _ := spdbridge.StorageProofOutputId(provenId, true, 1)
+	if payout := byContract[provenId]; !payout.ValidProof || payout.Height != 110 || payout.Timestamp != 5000 ||
+		len(payout.Outputs) != 2 || payout.Outputs[0].Value != "50" || payout.OutputIds[1] != validId {
+		t.Fatalf("unexpected payout of the proven contract %+v", payout)
+	}
+	missedOutputId, _ := spdbridge.StorageProofOutputId(missedId, false, 0)
+	if payout := byContract[missedId]; payout.ValidProof || payout.Height != 170 || payout.Timestamp != 1170 ||
+		len(payout.Outputs) != 1 || payout.OutputIds[0] != missedOutputId {
+		t.Fatalf("unexpected payout of the missed contract %+v", payout)
+	}
+	if hostPayouts[0].ContractId != provenId {
+		t.Fatalf("expected the host to be paid by the proven contract only, got %+v", hostPayouts)
+	}
+
+	//Payouts deep enough are cached, the open contract is fetched again
+	if err := addContractPayouts(context.Background(), explorerAddresses()); err != nil {
+		t.Fatal(err)
+	}
+	if fetched[provenId] != 1 || fetched[missedId] != 1 || fetched[openId] != 2 {
+		t.Fatalf("unexpected fetches %v", fetched)
+	}
+
+	result := filterTransactions(TransactionsBatchParams{Addresses: []string{renter}}, resp, newTransactionPoolSnapshot(&spdbridge.TransactionPoolResp{}))
+	var matured, immature int
+	for _, output := range result.DelayedOutputs {
+		if output.Source == transactionStorageProofPayout && output.Matured && output.MaturityHeight == 254 && output.Value == "50" {
+			matured++
+		} else if output.Source == transactionMissedProofPayout && !output.Matured && output.MaturityHeight == 314 {
+			immature++
+		}
+	}
+	if len(result.DelayedOutputs) != 2 || matured != 1 || immature != 1 {
+		t.Fatalf("unexpected delayed outputs %+v", result.DelayedOutputs)
+	}
+	var payoutTransaction *Transaction
+	for i, transaction := range result.Transactions {
+		if transaction.Id == provenId {
+			payoutTransaction = &result.Transactions[i]
+		}
+	}
+	if payoutTransaction == nil || payoutTransaction.Type != transactionStorageProofPayout || payoutTransaction.Height != 110 ||
+		payoutTransaction.BlockTimestamp != 5000 {
+		t.Fatalf("expected the matured contract payout in the history, got %+v", result.Transactions)
+	}
+
+}
@@ -1,37 +1,83 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
 	"io/ioutil"
 	"net/http"
 	"scp-app-api/spdbridge"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const standardFailResponse = "{\"status\":\"ko\"}"
 const standardSuccessResponse = "{\"status\":\"ok\"}"
 
+const batchRequestTimeout = 30 * time.Second
+
+//fullTransactionsVersion is the first API version returning every field of the transactions, such as the SPF
+//inputs and outputs and the file contracts
+const fullTransactionsVersion = 2
+
+var errTransactionSetsMismatch = errors.New("validateData and broadcastData contain different transactions")
+
+const (
+	transactionUnknown   = "unknown"
+	transactionPending   = "pending"
+	transactionConfirmed = "confirmed"
+)
+
+//failResponse is like standardFailResponse with the reason of the failure
+func failResponse(reason string) string {
+	jsonResp, _ := json.Marshal(struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}{"ko", reason})
+	return string(jsonResp)
+}
+
+//apiVersion parses the version of the request path, such as v1, defaulting to 1
+func apiVersion(ps httprouter.Params) int {
+	version, err := strconv.Atoi(strings.TrimPrefix(ps.ByName("version"), "v"))
+	if err != nil || version < 1 {
+		return 1
+	}
+	return version
+}
+
 //getScPrimeDataHandler handles requests to /scprime/data
 //Returns the cached network data and the cached SCP/USD exchange rate
 func getScPrimeDataHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	w.Header().Set("Content-Type", "application/json")
 
+	jsonResp, err := json.Marshal(buildNetworkDataResponse())
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//buildNetworkDataResponse aggregates the cached network data, SCP/USD exchange rate and USD exchange rates
+func buildNetworkDataResponse() NetworkDataResponse {
+
 	data, _ := GetNetworkData()
 	usdPrice, _ := GetFiatPrice()
 	exchangeRates, _ := GetUsdExchangeRates()
 
-	jsonResp, err := json.Marshal(NetworkDataResponse{
+	return NetworkDataResponse{
 		NetworkData:      data,
 		ScpPrice:         usdPrice,
 		USDExchangeRates: exchangeRates,
-	})
-	if err != nil {
-		http.Error(w, standardFailResponse, 500)
-		return
 	}
 
-	w.Write(jsonResp)
 }
 
 //getTransactionsHandler handles requests to /transactions/batch
@@ -51,21 +97,45 @@ func getAddressesTransactionsBatchHandler(w http.ResponseWriter, r *http.Request
 		http.Error(w, standardFailResponse, 400)
 		return
 	}
+	err = params.addUnlockConditions()
+	if err != nil {
+		http.Error(w, failResponse(err.Error()), 400)
+		return
+	}
 
-	explorerAddresses, err := spdbridge.ExplorerAddressesBatch(params.Addresses)
+	//The explorer lookup and the transaction pool share the same deadline and are fetched concurrently
+	ctx, cancel := context.WithTimeout(r.Context(), batchRequestTimeout)
+	defer cancel()
+
+	explorerAddresses, pool, err := GetAddressesAndPool(ctx, params.Addresses)
 	if err != nil {
 		http.Error(w, standardFailResponse, 500)
 		return
 	}
 
-	unconfirmedTransactions, err := spdbridge.GetTransactionPool()
+	transactions := filterTransactions(params, explorerAddresses, pool)
+	version := apiVersion(ps)
+	if version < fullTransactionsVersion {
+		transactions.Transactions = withoutSpfOnly(transactions.Transactions, params.Addresses, params.PublicKeys)
+	}
+	for i := range transactions.Transactions {
+		transactions.Transactions[i] = transactions.Transactions[i].forVersion(version)
+	}
+	jsonResp, err := json.Marshal(transactions)
 	if err != nil {
 		http.Error(w, standardFailResponse, 500)
 		return
 	}
 
-	transactions := filterTransactions(params, explorerAddresses, unconfirmedTransactions)
-	jsonResp, err := json.Marshal(transactions)
+	w.Write(jsonResp)
+}
+
+//getCacheStatsHandler handles requests to /cache/stats
+//Returns the hit/miss statistics of the explorer cache
+func getCacheStatsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	jsonResp, err := json.Marshal(GetExplorerCacheStats())
 	if err != nil {
 		http.Error(w, standardFailResponse, 500)
 		return
@@ -76,8 +146,8 @@ func getAddressesTransactionsBatchHandler(w http.ResponseWriter, r *http.Request
 
 //getTransactionsHandler handles requests to /transactions
 //Verifies and then broadcasts the transaction set provided
-//The data for the verification is sent separately from the data for the broadcast. This is done because they
-//need different formatting, and it's quicker for the client App to provide it rather than reformat it server side
+//The transaction set is either sent once as JSON and encoded server side, or as separate data for the verification
+//and for the broadcast, already formatted by the client App
 func newTransactionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -87,66 +157,351 @@ func newTransactionHandler(w http.ResponseWriter, r *http.Request, ps httprouter
 		return
 	}
 
+	//Retries carrying the same idempotency key get the result of the first request
+	var statusCode int
+	var resp string
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		statusCode, resp = submitTransaction(r.Context(), body)
+	} else {
+		statusCode, resp = idempotentRequest(key, body, func() (int, string) {
+			return submitTransaction(context.Background(), body)
+		})
+	}
+	if statusCode != 200 {
+		http.Error(w, resp, statusCode)
+		return
+	}
+
+	fmt.Fprint(w, resp)
+}
+
+//submitTransaction validates and broadcasts the transaction set in the request body, returning the response status
+//code and body. A transaction set already accepted by spd is reported as a success
+func submitTransaction(ctx context.Context, body []byte) (int, string) {
+
 	var newTransaction NewTransactionParams
-	err = json.Unmarshal(body, &newTransaction)
+	err := json.Unmarshal(body, &newTransaction)
 	if err != nil {
-		http.Error(w, standardFailResponse, 400)
-		return
+		return 400, standardFailResponse
+	}
+	_, err = prepareTransactionSet(&newTransaction)
+	if err != nil {
+		return 400, failResponse(err.Error())
 	}
 
 	result, err := spdbridge.ConsensusValidateTxns([]byte(newTransaction.ValidateData))
 	if err != nil || !result {
-		http.Error(w, standardFailResponse, 400)
-		return
+		if alreadyAccepted(ctx, newTransaction.BroadcastData.Transaction) {
+			return 200, standardSuccessResponse
+		}
+		return 400, standardFailResponse
 	}
 
 	resultBroadcast, err := spdbridge.TransactionPoolRaw(newTransaction.BroadcastData.Parents, newTransaction.BroadcastData.Transaction)
 	if err != nil || !resultBroadcast {
-		http.Error(w, standardFailResponse, 400)
+		if alreadyAccepted(ctx, newTransaction.BroadcastData.Transaction) {
+			return 200, standardSuccessResponse
+		}
+		return 400, standardFailResponse
+	}
+
+	//The transaction set is rebroadcast if it's dropped from the pool before being confirmed
+	_, err = trackBroadcast(newTransaction.BroadcastData.Parents, newTransaction.BroadcastData.Transaction)
+	if err != nil {
+		fmt.Printf("Error while tracking a broadcast transaction set: %v\n", err)
+	}
+
+	return 200, standardSuccessResponse
+
+}
+
+//prepareTransactionSet fills the data for the verification and for the broadcast from the JSON transaction set, when
+//it's provided, otherwise checks that the two describe the same transactions. Returns the decoded transaction set
+func prepareTransactionSet(newTransaction *NewTransactionParams) ([]spdbridge.Transaction, error) {
+
+	if len(newTransaction.TransactionSet) == 0 {
+		//Otherwise a client could get a transaction set verified and broadcast another one
+		return matchTransactionSets(newTransaction.ValidateData, newTransaction.BroadcastData)
+	}
+
+	var err error
+	newTransaction.ValidateData, newTransaction.BroadcastData, err = encodeTransactionSet(newTransaction.TransactionSet)
+	if err != nil {
+		return nil, errors.New("invalid transaction set")
+	}
+	return newTransaction.TransactionSet, nil
+
+}
+
+//encodeTransactionSet formats the transaction set for its verification, as JSON, and for its broadcast, with the last
+//transaction and its parents in spd's binary encoding
+func encodeTransactionSet(transactionSet []spdbridge.Transaction) (string, BroadcastData, error) {
+
+	validateData, err := json.Marshal(transactionSet)
+	if err != nil {
+		return "", BroadcastData{}, err
+	}
+	last := len(transactionSet) - 1
+	parents, err := spdbridge.EncodeTransactions(transactionSet[:last])
+	if err != nil {
+		return "", BroadcastData{}, err
+	}
+	transaction, err := spdbridge.EncodeTransaction(transactionSet[last])
+	if err != nil {
+		return "", BroadcastData{}, err
+	}
+
+	return string(validateData), BroadcastData{
+		Parents:     base64.StdEncoding.EncodeToString(parents),
+		Transaction: base64.StdEncoding.EncodeToString(transaction),
+	}, nil
+
+}
+
+//matchTransactionSets decodes the data for the verification and the data for the broadcast, returning an error
+//unless they contain the same transactions in the same order
+func matchTransactionSets(validateData string, broadcastData BroadcastData) ([]spdbridge.Transaction, error) {
+
+	var validateSet []spdbridge.Transaction
+	err := json.Unmarshal([]byte(validateData), &validateSet)
+	if err != nil {
+		return nil, errors.New("invalid validateData")
+	}
+	broadcastSet, err := spdbridge.ParseTransactions(broadcastData.Parents)
+	if err != nil {
+		return nil, errors.New("invalid broadcastData parents")
+	}
+	transaction, err := spdbridge.ParseTransaction(broadcastData.Transaction)
+	if err != nil {
+		return nil, errors.New("invalid broadcastData transaction")
+	}
+	broadcastSet = append(broadcastSet, *transaction)
+
+	if len(validateSet) != len(broadcastSet) {
+		return nil, errTransactionSetsMismatch
+	}
+	for i := range validateSet {
+		validateId, err := validateSet[i].Id()
+		if err != nil {
+			return nil, errors.New("invalid validateData")
+		}
+		broadcastId, err := broadcastSet[i].Id()
+		if err != nil {
+			return nil, errors.New("invalid broadcastData")
+		}
+		if validateId != broadcastId {
+			return nil, errTransactionSetsMismatch
+		}
+	}
+	return validateSet, nil
+
+}
+
+//alreadyAccepted tells whether the transaction, in any of the formats accepted by /tpool/raw, has already been
+//accepted by spd: it's tracked as broadcast, it's in the transaction pool or it's confirmed
+func alreadyAccepted(ctx context.Context, transaction string) bool {
+
+	parsed, err := spdbridge.ParseTransaction(transaction)
+	if err != nil {
+		return false
+	}
+	id, err := parsed.Id()
+	if err != nil {
+		return false
+	}
+
+	broadcasts.Lock()
+	broadcast, ok := broadcasts.broadcasts[id]
+	tracked := ok && (broadcast.Status == broadcastPending || broadcast.Status == broadcastConfirmed)
+	broadcasts.Unlock()
+	if tracked {
+		return true
+	}
+
+	pending, err := spdbridge.GetTransactionPoolRaw(ctx, id)
+	if err == nil && pending != nil {
+		return true
+	}
+	confirmed, err := spdbridge.TransactionPoolConfirmed(ctx, id)
+	return err == nil && confirmed
+
+}
+
+//getTransactionHandler handles requests to /transactions/:id
+//Returns whether the transaction is unknown, waiting in the transaction pool or confirmed, in which case
+//the response includes its height, confirmations and block timestamp
+func getTransactionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := ps.ByName("id")
+	if decoded, err := hex.DecodeString(id); err != nil || len(decoded) != 32 {
+		http.Error(w, failResponse("invalid transaction id"), 400)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), batchRequestTimeout)
+	defer cancel()
+
+	resp := TransactionStatusResp{Id: id, Status: transactionUnknown}
+	confirmed, err := confirmedTransaction(ctx, id)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
 		return
 	}
+	if confirmed != nil {
+		networkData, err := GetNetworkData()
+		if err != nil {
+			http.Error(w, standardFailResponse, 500)
+			return
+		}
+		transaction := newTransactionFromExplorer(*confirmed).forVersion(apiVersion(ps))
+		resp.Status = transactionConfirmed
+		resp.Height = confirmed.Height
+		resp.BlockTimestamp = confirmed.BlockTimestamp
+		resp.Transaction = &transaction
+		if networkData.ConsensusHeight >= confirmed.Height {
+			resp.Confirmations = networkData.ConsensusHeight - confirmed.Height + 1
+		}
+	} else {
+		pending, err := spdbridge.GetTransactionPoolRaw(ctx, id)
+		if err != nil {
+			http.Error(w, standardFailResponse, 500)
+			return
+		}
+		if pending != nil {
+			resp.Status = transactionPending
+		}
+	}
+
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//confirmedTransaction looks up the confirmed transaction in the local index, when it's used and caught up, or in the
+//spd explorer
+func confirmedTransaction(ctx context.Context, id string) (*spdbridge.ExplorerTransaction, error) {
+	if localIndex != nil && localIndex.caughtUp() {
+		return localIndex.Transaction(id)
+	}
+	return spdbridge.ExplorerTransactionById(ctx, id)
+}
+
+//addUnlockConditions adds the address and the public keys of the unlock conditions requested, so that the pool
+//transactions spending from a multisig address are attributed through any of its participants' keys
+func (params *TransactionsBatchParams) addUnlockConditions() error {
+
+	for _, unlockConditions := range params.UnlockConditions {
+		address, err := unlockConditions.UnlockHash()
+		if err != nil {
+			return errInvalidUnlockConditions
+		}
+		params.Addresses = append(params.Addresses, address)
+		for _, publicKey := range unlockConditions.PublicKeys {
+			params.PublicKeys = append(params.PublicKeys, publicKey.Key)
+		}
+	}
+	if len(params.UnlockConditions) > 0 {
+		params.Addresses = uniqueStrings(params.Addresses)
+		params.PublicKeys = uniqueStrings(params.PublicKeys)
+	}
+	return nil
 
-	fmt.Fprintf(w, standardSuccessResponse)
 }
 
-func filterTransactions(params TransactionsBatchParams, explorerAddresses *spdbridge.AddressesBatchResp, unconfirmedTransactions *spdbridge.TransactionPoolResp) (transactions TransactionsBatchResp) {
+//filterTransactions merges the explorer transactions of the requested addresses and their matured miner payouts with
+//the unconfirmed transactions paying to one of the requested addresses or spending from one of the requested public keys
+func filterTransactions(params TransactionsBatchParams, explorerAddresses *spdbridge.AddressesBatchResp, pool *transactionPoolSnapshot) (transactions TransactionsBatchResp) {
 
+	seenIds := make(map[string]struct{})
 	for _, explorerAddress := range explorerAddresses.Addresses {
-	expTransactions:
 		for _, explorerTransaction := range explorerAddress.Transactions {
-			transaction := newTransactionFromExplorer(explorerTransaction)
-			for _, currTransaction := range transactions.Transactions {
-				if currTransaction.Id == transaction.Id {
-					continue expTransactions
-				}
+			if _, ok := seenIds[explorerTransaction.Id]; ok {
+				continue
 			}
-			transactions.Transactions = append(transactions.Transactions, transaction)
+			seenIds[explorerTransaction.Id] = struct{}{}
+			transactions.Transactions = append(transactions.Transactions, newTransactionFromExplorer(explorerTransaction))
 		}
 	}
 
-utl:
-	for _, unconfirmedTransaction := range unconfirmedTransactions.Transactions {
-		for _, output := range unconfirmedTransaction.ScpOutputs {
-			for _, address := range params.Addresses {
-				if output.UnlockHash == address {
-					transaction := newTransactionFromUnconfirmed(unconfirmedTransaction)
-					transactions.Transactions = append(transactions.Transactions, transaction)
-					continue utl
-				}
-			}
+	var height uint64
+	if data := networkData; data != nil {
+		height = data.ConsensusHeight
+	}
+	var matured []Transaction
+	transactions.DelayedOutputs, matured = delayedOutputs(params.Addresses, explorerAddresses, height)
+	transactions.Transactions = append(transactions.Transactions, matured...)
+
+	for _, unconfirmedTransaction := range pool.relatedTransactions(params.Addresses, params.PublicKeys) {
+		transactions.Transactions = append(transactions.Transactions, newTransactionFromUnconfirmed(unconfirmedTransaction))
+	}
+	return transactions
+
+}
+
+//withoutSpfOnly removes the transactions related to the addresses and public keys only through their SPF inputs and
+//outputs, which carry nothing once stripped for the versions before fullTransactionsVersion
+func withoutSpfOnly(transactions []Transaction, addresses []string, publicKeys []string) []Transaction {
+
+	addressSet, publicKeySet := stringSet(addresses), stringSet(publicKeys)
+	filtered := make([]Transaction, 0, len(transactions))
+	for _, transaction := range transactions {
+		if !transaction.spfOnly(addressSet, publicKeySet) {
+			filtered = append(filtered, transaction)
+		}
+	}
+	return filtered
+
+}
+
+//spfOnly returns whether the transaction relates to the addresses or public keys through its SPF inputs and outputs
+//but not through its SCP ones
+func (t Transaction) spfOnly(addresses map[string]struct{}, publicKeys map[string]struct{}) bool {
+
+	related := func(address string, unlockConditions *spdbridge.UnlockConditions) bool {
+		if _, ok := addresses[address]; ok {
+			return true
+		}
+		if unlockConditions == nil {
+			return false
 		}
-		for _, input := range unconfirmedTransaction.ScpInputs {
-			for _, publicKey := range input.UnlockConditions.PublicKeys {
-				for _, filterPublicKey := range params.PublicKeys {
-					if publicKey.Key == filterPublicKey {
-						transaction := newTransactionFromUnconfirmed(unconfirmedTransaction)
-						transactions.Transactions = append(transactions.Transactions, transaction)
-						continue utl
-					}
-				}
+		for _, publicKey := range unlockConditions.PublicKeys {
+			if _, ok := publicKeys[publicKey.Key]; ok {
+				return true
 			}
 		}
+		if unlockHash, err := unlockConditions.UnlockHash(); err == nil {
+			_, ok := addresses[unlockHash]
+			return ok
+		}
+		return false
 	}
-	return transactions
+
+	spf := false
+	for _, output := range t.SpfOutputs {
+		spf = spf || related(output.UnlockHash, nil)
+	}
+	for i := range t.SpfInputs {
+		spf = spf || related(t.SpfInputs[i].ClaimUnlockHash, &t.SpfInputs[i].UnlockConditions)
+	}
+	if !spf {
+		return false
+	}
+	for _, output := range t.ScpOutputs {
+		if related(output.UnlockHash, nil) {
+			return false
+		}
+	}
+	for i := range t.ScpInputs {
+		if related("", &t.ScpInputs[i].UnlockConditions) {
+			return false
+		}
+	}
+	return true
 
 }
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"scp-app-api/spdbridge"
+	"strings"
+	"testing"
+)
+
+//filterTransactionsNaive is the original nested loops implementation of filterTransactions, kept as a reference
+func filterTransactionsNaive(params TransactionsBatchParams, explorerAddresses *spdbridge.AddressesBatchResp, unconfirmedTransactions *spdbridge.TransactionPoolResp) (transactions TransactionsBatchResp) {
+
+	for _, explorerAddress := range explorerAddresses.Addresses {
+	expTransactions:
+		for _, explorerTransaction := range explorerAddress.Transactions {
+			transaction := newTransactionFromExplorer(explorerTransaction)
+			for _, currTransaction := range transactions.Transactions {
+				if currTransaction.Id == transaction.Id {
+					continue expTransactions
+				}
+			}
+			transactions.Transactions = append(transactions.Transactions, transaction)
+		}
+	}
+
+utl:
+	for _, unconfirmedTransaction := range unconfirmedTransactions.Transactions {
+		for _, output := range unconfirmedTransaction.ScpOutputs {
+			for _, address := range params.Addresses {
+				if output.UnlockHash == address {
+					transactions.Transactions = append(transactions.Transactions, newTransactionFromUnconfirmed(unconfirmedTransaction))
+					continue utl
+				}
+			}
+		}
+		for _, input := range unconfirmedTransaction.ScpInputs {
+			for _, publicKey := range input.UnlockConditions.PublicKeys {
+				for _, filterPublicKey := range params.PublicKeys {
+					if publicKey.Key == filterPublicKey {
+						transactions.Transactions = append(transactions.Transactions, newTransactionFromUnconfirmed(unconfirmedTransaction))
+						continue utl
+					}
+				}
+			}
+		}
+	}
+	return transactions
+
+}
+
+//syntheticBatch builds a batch of addresses sharing transactions with each other and a transaction pool
+//where every fourth transaction pays to a requested address and every fourth spends from a requested key
+func syntheticBatch(addressesCount int, transactionsPerAddress int, poolSize int) (TransactionsBatchParams, *spdbridge.AddressesBatchResp, *spdbridge.TransactionPoolResp) {
+
+	var params TransactionsBatchParams
+	var explorerAddresses spdbridge.AddressesBatchResp
+	for i := 0; i < addressesCount; i++ {
+		address := fmt.Sprintf("address%d", i)
+		params.Addresses = append(params.Addresses, address)
+		params.PublicKeys = append(params.PublicKeys, fmt.Sprintf("key%d", i))
+
+		explorerAddress := spdbridge.ExplorerAddress{Address: address}
+		for j := 0; j < transactionsPerAddress; j++ {
+			//Consecutive addresses share half of their transactions, as it happens with change outputs
+			explorerAddress.Transactions = append(explorerAddress.Transactions, spdbridge.ExplorerTransaction{
+				Id:     fmt.Sprintf("transaction%d", i*transactionsPerAddress/2+j),
+				Height: uint64(i),
+			})
+		}
+		explorerAddresses.Addresses = append(explorerAddresses.Addresses, explorerAddress)
+	}
+
+	var pool spdbridge.TransactionPoolResp
+	for i := 0; i < poolSize; i++ {
+		transaction := spdbridge.RawTransaction{
+			ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: fmt.Sprintf("other%d", i)}},
+			ScpInputs: []spdbridge.ScpInput{{UnlockConditions: spdbridge.UnlockConditions{
+				PublicKeys: []spdbridge.ScpPublicKey{{Key: fmt.Sprintf("otherkey%d", i)}},
+			}}},
+			MinerFees: []string{fmt.Sprint(i)},
+		}
+		switch i % 4 {
+		case 1:
+			transaction.ScpOutputs = append(transaction.ScpOutputs, spdbridge.ScpOutput{UnlockHash: fmt.Sprintf("address%d", i%addressesCount)})
+		case 2:
+			transaction.ScpInputs[0].UnlockConditions.PublicKeys[0].Key = fmt.Sprintf("key%d", i%addressesCount)
+		}
+		pool.Transactions = append(pool.Transactions, transaction)
+	}
+
+	return params, &explorerAddresses, &pool
+
+}
+
+func TestFilterTransactions(t *testing.T) {
+
+	params, explorerAddresses, pool := syntheticBatch(50, 20, 200)
+
+	expected := filterTransactionsNaive(params, explorerAddresses, pool)
+	result := filterTransactions(params, explorerAddresses, newTransactionPoolSnapshot(pool))
+
+	if len(result.Transactions) != len(expected.Transactions) {
+		t.Fatalf("expected %v transactions, got %v", len(expected.Transactions), len(result.Transactions))
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatal("result differs from the reference implementation")
+	}
+
+}
+
+func TestFilterTransactionsEmpty(t *testing.T) {
+
+	result := filterTransactions(TransactionsBatchParams{}, &spdbridge.AddressesBatchResp{}, newTransactionPoolSnapshot(&spdbridge.TransactionPoolResp{}))
+	if len(result.Transactions) != 0 {
+		t.Fatalf("expected no transactions, got %v", len(result.Transactions))
+	}
+
+}
+
+//fakeSpd points spdbridge to a test server running handler for the duration of the test
+func fakeSpd(t *testing.T, handler http.Handler) {
+
+	server := httptest.NewServer(handler)
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	originalPort := spdbridge.SpdApiPort
+	spdbridge.SpdApiPort = serverURL.Port()
+	t.Cleanup(func() {
+		server.Close()
+		spdbridge.SpdApiPort = originalPort
+	})
+
+}
+
+func TestGetTransaction(t *testing.T) {
+
+	confirmedId := strings.Repeat("a", 64)
+	pendingId := strings.Repeat("b", 64)
+	unknownId := strings.Repeat("c", 64)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/explorer/hashes/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/explorer/hashes/") != confirmedId {
+			http.Error(w, "unrecognized hash used as input to /explorer/hash", 400)
+			return
+		}
+		json.NewEncoder(w).Encode(spdbridge.ExplorerHashResp{
+			HashType:    "transactionid",
+			Transaction: spdbridge.ExplorerTransaction{Id: confirmedId, Height: 8, BlockTimestamp: 1600000000},
+		})
+	})
+	mux.HandleFunc("/tpool/raw/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/tpool/raw/") != pendingId {
+			http.Error(w, "transaction not found in transaction pool", 400)
+			return
+		}
+		json.NewEncoder(w).Encode(spdbridge.TransactionPoolRawResp{Id: pendingId})
+	})
+	fakeSpd(t, mux)
+	networkData = &NetworkData{ConsensusHeight: 10}
+
+	server := httptest.NewServer(buildRouter())
+	defer server.Close()
+
+	tests := []struct {
+		id            string
+		statusCode    int
+		status        string
+		confirmations uint64
+	}{
+		{confirmedId, 200, transactionConfirmed, 3},
+		{pendingId, 200, transactionPending, 0},
+		{unknownId, 200, transactionUnknown, 0},
+		{"abc", 400, "ko", 0},
+	}
+	for _, test := range tests {
+		resp, err := http.Get(server.URL + "/v1/transactions/" + test.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var status TransactionStatusResp
+		json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if resp.StatusCode != test.statusCode || status.Status != test.status || status.Confirmations != test.confirmations {
+			t.Errorf("%v: unexpected response %v %+v", test.id, resp.StatusCode, status)
+		}
+	}
+
+}
+
+func TestNewTransactionFromTransactionSet(t *testing.T) {
+
+	dataDir = t.TempDir()
+
+	parent := spdbridge.Transaction{ArbitraryData: [][]byte{[]byte("parent")}}
+	transaction := spdbridge.Transaction{ArbitraryData: [][]byte{[]byte("transaction")}}
+
+	var validated []spdbridge.Transaction
+	var broadcastParents, broadcastTransaction string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/consensus/validate/transactionset", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&validated)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/tpool/raw", func(w http.ResponseWriter, r *http.Request) {
+		broadcastParents, broadcastTransaction = r.FormValue("parents"), r.FormValue("transaction")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	fakeSpd(t, mux)
+
+	body, _ := json.Marshal(NewTransactionParams{TransactionSet: []spdbridge.Transaction{parent, transaction}})
+	recorder := httptest.NewRecorder()
+	newTransactionHandler(recorder, httptest.NewRequest("POST", "/v1/transactions", strings.NewReader(string(body))), nil)
+	if recorder.Code != 200 {
+		t.Fatalf("expected status 200, got %v %v", recorder.Code, recorder.Body.String())
+	}
+
+	if len(validated) != 2 || string(validated[1].ArbitraryData[0]) != "transaction" {
+		t.Fatalf("unexpected validated transaction set %+v", validated)
+	}
+	if broadcastParents != encodeTestTransactions(t, parent) {
+		t.Fatalf("unexpected broadcast parents %v", broadcastParents)
+	}
+	decoded, err := spdbridge.ParseTransaction(broadcastTransaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := decoded.Id()
+	if expected, _ := transaction.Id(); id != expected {
+		t.Fatalf("expected transaction %v to be broadcast, got %v", expected, id)
+	}
+
+	invalid := spdbridge.Transaction{ScpOutputs: []spdbridge.ScpOutput{{Value: "not a number"}}}
+	body, _ = json.Marshal(NewTransactionParams{TransactionSet: []spdbridge.Transaction{invalid}})
+	recorder = httptest.NewRecorder()
+	newTransactionHandler(recorder, httptest.NewRequest("POST", "/v1/transactions", strings.NewReader(string(body))), nil)
+	if recorder.Code != 400 {
+		t.Fatalf("expected status 400 for an invalid transaction set, got %v", recorder.Code)
+	}
+
+}
+
+func TestMatchTransactionSets(t *testing.T) {
+
+	parent := spdbridge.Transaction{ArbitraryData: [][]byte{[]byte("parent")}}
+	transaction := spdbridge.Transaction{ArbitraryData: [][]byte{[]byte("transaction")}}
+	other := spdbridge.Transaction{ArbitraryData: [][]byte{[]byte("other")}}
+	validateData, _ := json.Marshal([]spdbridge.Transaction{parent, transaction})
+	transactionJSON, _ := json.Marshal(transaction)
+
+	//The transaction is sent in raw binary, the parents in base64
+	encoded, _ := spdbridge.EncodeTransaction(transaction)
+	broadcastData := BroadcastData{Parents: encodeTestTransactions(t, parent), Transaction: string(encoded)}
+	if _, err := matchTransactionSets(string(validateData), broadcastData); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := matchTransactionSets(string(validateData), BroadcastData{Parents: "[]", Transaction: string(transactionJSON)}); err != errTransactionSetsMismatch {
+		t.Fatalf("expected a missing parent to be a mismatch, got %v", err)
+	}
+	broadcastData.Parents = encodeTestTransactions(t, other)
+	if _, err := matchTransactionSets(string(validateData), broadcastData); err != errTransactionSetsMismatch {
+		t.Fatalf("expected a different parent to be a mismatch, got %v", err)
+	}
+	if _, err := matchTransactionSets("not json", broadcastData); err == nil || err == errTransactionSetsMismatch {
+		t.Fatalf("expected invalid validateData to be reported, got %v", err)
+	}
+
+}
+
+func TestTransactionVersions(t *testing.T) {
+
+	var explorerTransaction spdbridge.ExplorerTransaction
+	err := json.Unmarshal([]byte(`{"id":"tx1","height":5,"rawtransaction":{"minerfees":["10"],
+		"siafundoutputs":[{"value":"2","unlockhash":"addr","claimstart":"0"}],"arbitrarydata":["aGVsbG8="]}}`), &explorerTransaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transaction := newTransactionFromExplorer(explorerTransaction)
+
+	for _, test := range []struct {
+		version string
+		full    bool
+	}{{"v1", false}, {"v2", true}, {"v3", true}, {"latest", false}} {
+		versioned := transaction.forVersion(apiVersion(httprouter.Params{{Key: "version", Value: test.version}}))
+		jsonTransaction, _ := json.Marshal(versioned)
+		full := strings.Contains(string(jsonTransaction), `"siafundoutputs":[{"value":"2"`) &&
+			strings.Contains(string(jsonTransaction), `"arbitrarydata":["aGVsbG8="]`)
+		if full != test.full || versioned.Id != "tx1" || versioned.MinerFees[0] != "10" {
+			t.Fatalf("unexpected %v transaction %s", test.version, jsonTransaction)
+		}
+	}
+
+}
+
+//benchmarkFilterTransactions measures filterTransactions, the pool snapshot is indexed once outside
+//the timer since it's shared by all the requests of a sync interval
+func benchmarkFilterTransactions(b *testing.B, addressesCount int) {
+
+	params, explorerAddresses, pool := syntheticBatch(addressesCount, 10, 5000)
+	snapshot := newTransactionPoolSnapshot(pool)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filterTransactions(params, explorerAddresses, snapshot)
+	}
+
+}
+
+func benchmarkFilterTransactionsNaive(b *testing.B, addressesCount int) {
+
+	params, explorerAddresses, pool := syntheticBatch(addressesCount, 10, 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filterTransactionsNaive(params, explorerAddresses, pool)
+	}
+
+}
+
+func BenchmarkFilterTransactions1000(b *testing.B) {
+	benchmarkFilterTransactions(b, 1000)
+}
+
+func BenchmarkFilterTransactions5000(b *testing.B) {
+	benchmarkFilterTransactions(b, 5000)
+}
+
+func BenchmarkFilterTransactionsNaive1000(b *testing.B) {
+	benchmarkFilterTransactionsNaive(b, 1000)
+}
+
+func BenchmarkFilterTransactionsNaive5000(b *testing.B) {
+	benchmarkFilterTransactionsNaive(b, 5000)
+}
+
+func BenchmarkNewTransactionPoolSnapshot(b *testing.B) {
+
+	_, _, pool := syntheticBatch(1, 1, 5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newTransactionPoolSnapshot(pool)
+	}
+
+}
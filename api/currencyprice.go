@@ -110,12 +110,12 @@ func getUsdExchangeRates() (*map[string]float64, error) {
 	client := http.Client{}
 	request, err := http.NewRequest("GET", "https://api.getgeoapi.com/v2/currency/convert?api_key="+GetGeoApiKey+"&from=USD&to="+currencyList+"&format=json", nil)
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
 
 	response, err := client.Do(request)
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
 	defer response.Body.Close()
 
@@ -10,6 +10,9 @@ const GetGeoApiKeyTest = ""
 
 func TestGetFiatExchangeRates(t *testing.T) {
 
+	if GetGeoApiKeyTest == "" {
+		t.Skip("no getgeo api key provided")
+	}
 	GetGeoApiKey = GetGeoApiKeyTest
 
 	response, e := getUsdExchangeRates()
@@ -19,7 +22,7 @@ func TestGetFiatExchangeRates(t *testing.T) {
 
 fiatsLoop:
 	for _, currency := range supportedFiats {
-		for rateCurrency := range response.Rates {
+		for rateCurrency := range *response {
 			if currency == rateCurrency {
 				continue fiatsLoop
 			}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"reflect"
 	"scp-app-api/spdbridge"
+	"sync"
 	"time"
 )
 
@@ -18,6 +21,9 @@ var networkData *NetworkData = nil
 var usdPrice *float64 = nil
 var exchangeRates *map[string]float64 = nil
 
+var transactionPool *transactionPoolSnapshot = nil
+var transactionPoolMutex sync.RWMutex
+
 //GetNetworkData returns the cached ScPrime network data
 func GetNetworkData() (*NetworkData, error) {
 
@@ -63,10 +69,47 @@ func GetUsdExchangeRates() (*map[string]float64, error) {
 
 }
 
+//GetTransactionPool returns the cached and indexed spd transaction pool
+func GetTransactionPool(ctx context.Context) (*transactionPoolSnapshot, error) {
+
+	transactionPoolMutex.RLock()
+	snapshot := transactionPool
+	transactionPoolMutex.RUnlock()
+
+	if snapshot == nil {
+		newData, err := downloadTransactionPool(ctx)
+		if err != nil {
+			fmt.Printf("Error while fetching spd transaction pool: %v\n", err)
+			return nil, err
+		}
+		transactionPoolMutex.Lock()
+		transactionPool = newData
+		transactionPoolMutex.Unlock()
+		snapshot = newData
+	}
+	return snapshot, nil
+
+}
+
 //StartDataSync starts the caching of the data
 func StartDataSync() {
 
-	go syncNetworkData(nil)
+	//Cached explorer lookups are stale as soon as a new block is found
+	OnHeightChanged(func(oldHeight uint64, newHeight uint64) {
+		invalidateExplorerCache(newHeight)
+	})
+	StartWebSocketHub()
+	StartNetworkDataStream()
+	StartWebhooks()
+	StartPushRelay()
+	StartInvoices()
+	StartBroadcastTracker()
+	StartFeeEstimator()
+	StartIdempotencySweep()
+
+	changedHeight := notifyHeightChanged
+	go syncNetworkData(&changedHeight)
+	go syncTransactionPool()
 	go syncUsdQuote()
 	go syncUsdExchangeRates()
 
@@ -84,20 +127,46 @@ func syncNetworkData(changedHeight *func(uint64, uint64)) {
 		return
 	}
 
+	oldData := networkData
 	var oldHeight uint64
-	if networkData != nil {
-		oldHeight = networkData.ConsensusHeight
+	if oldData != nil {
+		oldHeight = oldData.ConsensusHeight
 	}
 	networkData = newData
 	if oldHeight < newData.ConsensusHeight && changedHeight != nil {
 		(*changedHeight)(oldHeight, newData.ConsensusHeight)
 	}
+	if oldData == nil || *oldData != *newData {
+		notifyNetworkDataChanged()
+	}
 
 	time.Sleep(networkSyncInterval)
 	go syncNetworkData(changedHeight)
 
 }
 
+func syncTransactionPool() {
+
+	newData, err := downloadTransactionPool(context.Background())
+	if err != nil {
+		if verbose {
+			fmt.Printf("Error while fetching spd transaction pool: %v\n", err)
+		}
+		time.Sleep(networkSyncInterval)
+		go syncTransactionPool()
+		return
+	}
+
+	transactionPoolMutex.Lock()
+	transactionPool = newData
+	transactionPoolMutex.Unlock()
+	notifyPoolChanged(newData)
+
+	time.Sleep(networkSyncInterval)
+	go syncTransactionPool()
+
+}
+
 func syncUsdQuote() {
 
 	newData, err := getScpUsdQuote()
@@ -107,7 +176,11 @@ func syncUsdQuote() {
 		go syncUsdQuote()
 		return
 	}
+	changed := usdPrice == nil || *usdPrice != *newData
 	usdPrice = newData
+	if changed {
+		notifyNetworkDataChanged()
+	}
 
 	time.Sleep(usdPriceSyncInterval)
 	go syncUsdQuote()
@@ -123,7 +196,11 @@ func syncUsdExchangeRates() {
 		go syncUsdExchangeRates()
 		return
 	}
+	changed := exchangeRates == nil || !reflect.DeepEqual(*exchangeRates, *newData)
 	exchangeRates = newData
+	if changed {
+		notifyNetworkDataChanged()
+	}
 
 	time.Sleep(usdExchangeRatesSyncInterval)
 	go syncUsdExchangeRates()
@@ -131,7 +208,7 @@ func syncUsdExchangeRates() {
 }
 
 //downloadNetworkData downloads and aggregates the following data from spd:
-//consensus height, min transaction fee, max transaction fee
+//consensus height, current block, min transaction fee, max transaction fee
 func downloadNetworkData() (*NetworkData, error) {
 
 	consensus, err := spdbridge.GetConsensus()
@@ -146,6 +223,7 @@ func downloadNetworkData() (*NetworkData, error) {
 
 	var newData = NetworkData{
 		ConsensusHeight: consensus.Height,
+		CurrentBlock:    consensus.CurrentBlock,
 		MinFee:          fees.MinFee,
 		MaxFee:          fees.MaxFee,
 	}
@@ -156,3 +234,15 @@ func downloadNetworkData() (*NetworkData, error) {
 	return &newData, nil
 
 }
+
+//downloadTransactionPool downloads the spd transaction pool and indexes it by address and public key
+func downloadTransactionPool(ctx context.Context) (*transactionPoolSnapshot, error) {
+
+	pool, err := spdbridge.GetTransactionPoolWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTransactionPoolSnapshot(pool), nil
+
+}
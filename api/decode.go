@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"scp-app-api/spdbridge"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//decodeTransactionHandler handles requests to /transactions/decode
+//Decodes the transaction set, or the single transaction, in the request body and returns a readable view of it.
+//The body can be JSON, base64 or the raw ScPrime binary encoding
+func decodeTransactionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil || len(body) == 0 {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+
+	transactions, err := parseTransactionData(string(body))
+	if err != nil {
+		//Text bodies often carry a trailing newline, raw binary ones are tried as they are first
+		transactions, err = parseTransactionData(strings.TrimSpace(string(body)))
+	}
+	if err != nil {
+		http.Error(w, failResponse("invalid transaction data"), 400)
+		return
+	}
+
+	resp := DecodedTransactionsResp{Transactions: []DecodedTransaction{}}
+	for i := range transactions {
+		decoded, err := decodeTransaction(&transactions[i])
+		if err != nil {
+			http.Error(w, failResponse(err.Error()), 400)
+			return
+		}
+		resp.Transactions = append(resp.Transactions, *decoded)
+	}
+
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//parseTransactionData parses a transaction set, falling back to a single transaction
+func parseTransactionData(data string) ([]spdbridge.Transaction, error) {
+
+	transactions, err := spdbridge.ParseTransactions(data)
+	if err == nil {
+		return transactions, nil
+	}
+	transaction, err := spdbridge.ParseTransaction(data)
+	if err != nil {
+		return nil, err
+	}
+	return []spdbridge.Transaction{*transaction}, nil
+
+}
+
+//decodeTransaction builds the readable view of the transaction, deriving the ids of its outputs and the addresses
+//of its inputs
+func decodeTransaction(transaction *spdbridge.Transaction) (*DecodedTransaction, error) {
+
+	id, err := transaction.Id()
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := spdbridge.EncodeTransaction(*transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded := DecodedTransaction{
+		Id:                    id,
+		Type:                  classifyTransaction(spdbridge.RawTransaction(*transaction)),
+		Size:                  uint64(len(encoded)),
+		ScpInputs:             []DecodedScpInput{},
+		ScpOutputs:            []DecodedScpOutput{},
+		MinerFees:             []DecodedAmount{},
+		SpfInputs:             []DecodedSpfInput{},
+		SpfOutputs:            transaction.SpfOutputs,
+		FileContracts:         transaction.FileContracts,
+		FileContractRevisions: transaction.FileContractRevisions,
+		StorageProofs:         []DecodedStorageProof{},
+		ArbitraryData:         []DecodedArbitraryData{},
+		Signatures:            []DecodedSignature{},
+	}
+	if decoded.SpfOutputs == nil {
+		decoded.SpfOutputs = []spdbridge.SpfOutput{}
+	}
+	if decoded.FileContracts == nil {
+		decoded.FileContracts = []spdbridge.FileContract{}
+	}
+	if decoded.FileContractRevisions == nil {
+		decoded.FileContractRevisions = []spdbridge.FileContractRevision{}
+	}
+
+	for _, input := range transaction.ScpInputs {
+		address, err := input.UnlockConditions.UnlockHash()
+		if err != nil {
+			return nil, err
+		}
+		decoded.ScpInputs = append(decoded.ScpInputs, DecodedScpInput{
+			ParentId:         input.ParentId,
+			Address:          address,
+			UnlockConditions: input.UnlockConditions,
+		})
+	}
+	for i, output := range transaction.ScpOutputs {
+		outputId, err := transaction.ScpOutputId(uint64(i))
+		if err != nil {
+			return nil, err
+		}
+		decoded.ScpOutputs = append(decoded.ScpOutputs, DecodedScpOutput{
+			Id:            outputId,
+			Address:       output.UnlockHash,
+			DecodedAmount: decodedAmount(output.Value),
+		})
+	}
+
+	totalFee := new(big.Int)
+	for _, fee := range transaction.MinerFees {
+		decoded.MinerFees = append(decoded.MinerFees, decodedAmount(fee))
+		if value, ok := new(big.Int).SetString(fee, 10); ok {
+			totalFee.Add(totalFee, value)
+		}
+	}
+	decoded.TotalFee = decodedAmount(totalFee.String())
+
+	for _, input := range transaction.SpfInputs {
+		address, err := input.UnlockConditions.UnlockHash()
+		if err != nil {
+			return nil, err
+		}
+		decoded.SpfInputs = append(decoded.SpfInputs, DecodedSpfInput{
+			ParentId:         input.ParentId,
+			Address:          address,
+			ClaimAddress:     input.ClaimUnlockHash,
+			UnlockConditions: input.UnlockConditions,
+		})
+	}
+	for _, proof := range transaction.StorageProofs {
+		decoded.StorageProofs = append(decoded.StorageProofs, DecodedStorageProof{
+			ParentId: proof.ParentId,
+			Segment:  hex.EncodeToString(proof.Segment[:]),
+			HashSet:  proof.HashSet,
+		})
+	}
+	for _, data := range transaction.ArbitraryData {
+		arbitraryData := DecodedArbitraryData{Hex: hex.EncodeToString(data)}
+		if isPrintable(data) {
+			arbitraryData.Text = string(data)
+		}
+		decoded.ArbitraryData = append(decoded.ArbitraryData, arbitraryData)
+	}
+	for _, signature := range transaction.TransactionSignatures {
+		decoded.Signatures = append(decoded.Signatures, DecodedSignature{
+			ParentId:       signature.ParentId,
+			PublicKeyIndex: signature.PublicKeyIndex,
+			Timelock:       signature.Timelock,
+			CoveredFields:  signature.CoveredFields,
+			Signature:      hex.EncodeToString(signature.Signature),
+		})
+	}
+
+	return &decoded, nil
+
+}
+
+//decodedAmount shows an amount in hastings along with its exact value in SCP
+func decodedAmount(hastings string) DecodedAmount {
+	amount := DecodedAmount{Value: hastings}
+	if value, ok := new(big.Int).SetString(hastings, 10); ok {
+		amount.Scp = formatScp(value, 27)
+	}
+	return amount
+}
+
+//isPrintable tells whether the arbitrary data is readable text
+func isPrintable(data []byte) bool {
+	if len(data) == 0 || !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeTransaction(t *testing.T) {
+
+	set, err := ioutil.ReadFile("../spdbridge/testdata/transactionset.b64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	single, err := ioutil.ReadFile("../spdbridge/testdata/transaction.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decode := func(body string) (int, DecodedTransactionsResp) {
+		recorder := httptest.NewRecorder()
+		decodeTransactionHandler(recorder, httptest.NewRequest("POST", "/v1/transactions/decode", strings.NewReader(body)), nil)
+		var resp DecodedTransactionsResp
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		return recorder.Code, resp
+	}
+
+	//The base64 file ends with a newline
+	statusCode, resp := decode(string(set))
+	if statusCode != 200 || len(resp.Transactions) != 2 {
+		t.Fatalf("expected 2 transactions, got %v %+v", statusCode, resp)
+	}
+	statusCode, singleResp := decode(string(single))
+	if statusCode != 200 || len(singleResp.Transactions) != 1 {
+		t.Fatalf("expected a single transaction, got %v %+v", statusCode, singleResp)
+	}
+
+	decoded := singleResp.Transactions[0]
+	if decoded.Id != resp.Transactions[0].Id || decoded.Id != "8ae62e18a64fc3cde9d3872d49181a98ffd286140017932f456eaa9c397a7121" {
+		t.Fatalf("unexpected id %v", decoded.Id)
+	}
+	if decoded.ScpInputs[0].Address != "898ffe66dbcddd36cb88fc2808dfea399d77fe2eb253654cbda06a8150651a9b2056b659a987" {
+		t.Fatalf("unexpected input address %v", decoded.ScpInputs[0].Address)
+	}
+	if decoded.ScpOutputs[0].Value != "1000000" || decoded.ScpOutputs[0].Scp != "0.000000000000000000001" || len(decoded.ScpOutputs[0].Id) != 64 {
+		t.Fatalf("unexpected output %+v", decoded.ScpOutputs[0])
+	}
+	if len(decoded.SpfInputs) != 1 || decoded.SpfInputs[0].Address == "" || len(decoded.FileContracts) != 1 ||
+		len(decoded.StorageProofs[0].Segment) != 128 || decoded.ArbitraryData[0].Text != "hello" || len(decoded.Signatures) != 2 {
+		t.Fatalf("unexpected decoded transaction %+v", decoded)
+	}
+
+	if statusCode, _ := decode("not a transaction"); statusCode != 400 {
+		t.Fatalf("expected status 400, got %v", statusCode)
+	}
+
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"scp-app-api/spdbridge"
+	"sync"
+)
+
+//Listeners are registered before StartDataSync and called by the sync loops whenever the cached data changes.
+//They run synchronously on the sync goroutine, so they must not block
+var listeners = struct {
+	sync.RWMutex
+	height      []func(oldHeight uint64, newHeight uint64)
+	pool        []func(snapshot *transactionPoolSnapshot)
+	networkData []func()
+}{}
+
+//OnHeightChanged registers a function called when the consensus height increases
+func OnHeightChanged(listener func(oldHeight uint64, newHeight uint64)) {
+	listeners.Lock()
+	defer listeners.Unlock()
+	listeners.height = append(listeners.height, listener)
+}
+
+//OnPoolChanged registers a function called when a new transaction pool snapshot is downloaded
+func OnPoolChanged(listener func(snapshot *transactionPoolSnapshot)) {
+	listeners.Lock()
+	defer listeners.Unlock()
+	listeners.pool = append(listeners.pool, listener)
+}
+
+//OnNetworkDataChanged registers a function called when the consensus height, the fees,
+//the SCP price or the fiat exchange rates change
+func OnNetworkDataChanged(listener func()) {
+	listeners.Lock()
+	defer listeners.Unlock()
+	listeners.networkData = append(listeners.networkData, listener)
+}
+
+func notifyHeightChanged(oldHeight uint64, newHeight uint64) {
+	listeners.RLock()
+	defer listeners.RUnlock()
+	for _, listener := range listeners.height {
+		listener(oldHeight, newHeight)
+	}
+}
+
+func notifyPoolChanged(snapshot *transactionPoolSnapshot) {
+	listeners.RLock()
+	defer listeners.RUnlock()
+	for _, listener := range listeners.pool {
+		listener(snapshot)
+	}
+}
+
+func notifyNetworkDataChanged() {
+	listeners.RLock()
+	defer listeners.RUnlock()
+	for _, listener := range listeners.networkData {
+		listener()
+	}
+}
+
+//newPoolTransactions returns the positions in the snapshot of the transactions related to the addresses and public
+//keys whose key is not in seen, along with the keys of all the related transactions to be used as seen next time
+func newPoolTransactions(snapshot *transactionPoolSnapshot, addresses []string, publicKeys []string, seen map[string]struct{}) (fresh []int, related map[string]struct{}) {
+
+	related = make(map[string]struct{})
+	for _, i := range snapshot.relatedIndexes(addresses, publicKeys) {
+		key := snapshot.Keys[i]
+		related[key] = struct{}{}
+		if _, ok := seen[key]; !ok {
+			fresh = append(fresh, i)
+		}
+	}
+	return fresh, related
+
+}
+
+//confirmedTransactions returns the explorer transactions of the addresses confirmed in the blocks
+//after oldHeight up to newHeight, without duplicates
+func confirmedTransactions(addresses []string, oldHeight uint64, newHeight uint64) ([]spdbridge.ExplorerTransaction, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), batchRequestTimeout)
+	defer cancel()
+	explorerAddresses, err := GetExplorerAddresses(ctx, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	var confirmed []spdbridge.ExplorerTransaction
+	seenIds := make(map[string]struct{})
+	for _, explorerAddress := range explorerAddresses.Addresses {
+		for _, explorerTransaction := range explorerAddress.Transactions {
+			if explorerTransaction.Height <= oldHeight || explorerTransaction.Height > newHeight {
+				continue
+			}
+			if _, ok := seenIds[explorerTransaction.Id]; ok {
+				continue
+			}
+			seenIds[explorerTransaction.Id] = struct{}{}
+			confirmed = append(confirmed, explorerTransaction)
+		}
+	}
+	return confirmed, nil
+
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"golang.org/x/sync/singleflight"
+	"scp-app-api/spdbridge"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//explorerCacheTTL bounds the life of a cached address in case the consensus height stops advancing
+const explorerCacheTTL = 5 * time.Minute
+
+type (
+	explorerCacheEntry struct {
+		address   spdbridge.ExplorerAddress
+		fetchedAt time.Time
+	}
+
+	ExplorerCacheStats struct {
+		Hits          uint64 `json:"hits"`
+		Misses        uint64 `json:"misses"`
+		Coalesced     uint64 `json:"coalesced"`
+		Invalidations uint64 `json:"invalidations"`
+		Entries       int    `json:"entries"`
+		Height        uint64 `json:"height"`
+	}
+)
+
+var explorerCache = struct {
+	sync.Mutex
+	entries    map[string]explorerCacheEntry
+	generation uint64
+	stats      ExplorerCacheStats
+}{entries: make(map[string]explorerCacheEntry)}
+
+var explorerRequests singleflight.Group
+
+//fetchExplorerAddresses is the source of the explorer data cached
+var fetchExplorerAddresses = spdbridge.ExplorerAddressesBatchWithContext
+
+//GetExplorerAddresses returns the explorer transactions of the addresses requested, with the payouts of their contracts
+//Addresses are served from the cache when possible, the remaining ones are requested to spd and identical
+//concurrent requests are coalesced in a single spd call
+func GetExplorerAddresses(ctx context.Context, addresses []string) (*spdbridge.AddressesBatchResp, error) {
+
+	addresses = uniqueStrings(addresses)
+
+	var cached []spdbridge.ExplorerAddress
+	var missing []string
+	now := time.Now()
+	explorerCache.Lock()
+	for _, address := range addresses {
+		entry, ok := explorerCache.entries[address]
+		if ok && now.Sub(entry.fetchedAt) < explorerCacheTTL {
+			cached = append(cached, entry.address)
+		} else {
+			missing = append(missing, address)
+		}
+	}
+	explorerCache.stats.Hits += uint64(len(addresses) - len(missing))
+	explorerCache.stats.Misses += uint64(len(missing))
+	generation := explorerCache.generation
+	explorerCache.Unlock()
+
+	fetched := &spdbridge.AddressesBatchResp{}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		//The shared request must not be canceled by the first caller leaving, so it gets its own deadline
+		resultChan := explorerRequests.DoChan(strings.Join(missing, ","), func() (interface{}, error) {
+			fetchCtx, cancel := context.WithTimeout(context.Background(), batchRequestTimeout)
+			defer cancel()
+			resp, err := fetchExplorerAddresses(fetchCtx, missing)
+			if err != nil {
+				return nil, err
+			}
+			return resp, addContractPayouts(fetchCtx, resp)
+		})
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case result := <-resultChan:
+			if result.Err != nil {
+				return nil, result.Err
+			}
+			fetched = result.Val.(*spdbridge.AddressesBatchResp)
+			if result.Shared {
+				explorerCache.Lock()
+				explorerCache.stats.Coalesced++
+				explorerCache.Unlock()
+			}
+		}
+		storeExplorerAddresses(missing, fetched, generation)
+	}
+
+	//The explorer only returns addresses with at least one transaction or miner payout, empty entries are left out
+	//the same way
+	var response spdbridge.AddressesBatchResp
+	for _, explorerAddress := range append(cached, fetched.Addresses...) {
+		if len(explorerAddress.Transactions) > 0 || len(explorerAddress.Blocks) > 0 {
+			response.Addresses = append(response.Addresses, explorerAddress)
+		}
+	}
+	return &response, nil
+
+}
+
+//GetAddressesAndPool returns the explorer transactions of the addresses and the transaction pool, fetched concurrently
+//under the same context
+func GetAddressesAndPool(ctx context.Context, addresses []string) (*spdbridge.AddressesBatchResp, *transactionPoolSnapshot, error) {
+
+	var explorerAddresses *spdbridge.AddressesBatchResp
+	var pool *transactionPoolSnapshot
+	var explorerErr, poolErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		explorerAddresses, explorerErr = GetExplorerAddresses(ctx, addresses)
+	}()
+	go func() {
+		defer wg.Done()
+		pool, poolErr = GetTransactionPool(ctx)
+	}()
+	wg.Wait()
+	if explorerErr != nil {
+		return nil, nil, explorerErr
+	}
+	if poolErr != nil {
+		return nil, nil, poolErr
+	}
+	return explorerAddresses, pool, nil
+
+}
+
+//GetExplorerCacheStats returns the hit/miss statistics of the explorer cache
+func GetExplorerCacheStats() ExplorerCacheStats {
+
+	explorerCache.Lock()
+	defer explorerCache.Unlock()
+	stats := explorerCache.stats
+	stats.Entries = len(explorerCache.entries)
+	return stats
+
+}
+
+//invalidateExplorerCache drops every cached address, since a new block may contain transactions for any of them
+func invalidateExplorerCache(newHeight uint64) {
+
+	explorerCache.Lock()
+	defer explorerCache.Unlock()
+	explorerCache.entries = make(map[string]explorerCacheEntry)
+	explorerCache.generation++
+	explorerCache.stats.Invalidations++
+	explorerCache.stats.Height = newHeight
+
+}
+
+//storeExplorerAddresses caches the explorer response for the addresses requested, addresses missing from the
+//response have no transactions and are cached as empty. Nothing is stored if the cache has been invalidated
+//while the request was in flight, since the response may predate the new block
+func storeExplorerAddresses(requested []string, resp *spdbridge.AddressesBatchResp, generation uint64) {
+
+	explorerCache.Lock()
+	defer explorerCache.Unlock()
+	if explorerCache.generation != generation {
+		return
+	}
+
+	now := time.Now()
+	for _, address := range requested {
+		explorerCache.entries[address] = explorerCacheEntry{
+			address:   spdbridge.ExplorerAddress{Address: address},
+			fetchedAt: now,
+		}
+	}
+	for _, explorerAddress := range resp.Addresses {
+		explorerCache.entries[explorerAddress.Address] = explorerCacheEntry{
+			address:   explorerAddress,
+			fetchedAt: now,
+		}
+	}
+
+}
+
+//uniqueStrings returns the values provided without duplicates, preserving their order
+func uniqueStrings(values []string) []string {
+
+	seen := make(map[string]struct{}, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if _, ok := seen[value]; !ok {
+			seen[value] = struct{}{}
+			unique = append(unique, value)
+		}
+	}
+	return unique
+
+}
+
+//stringSet returns the values as a set, for constant time lookups
+func stringSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		set[value] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"scp-app-api/spdbridge"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//fakeExplorer replaces fetchExplorerAddresses with a fake returning one transaction for every address
+//but "empty", the returned counter tracks the calls made
+func fakeExplorer(t *testing.T, delay time.Duration) *int32 {
+
+	var calls int32
+	original := fetchExplorerAddresses
+	fetchExplorerAddresses = func(ctx context.Context, addresses []string) (*spdbridge.AddressesBatchResp, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(delay)
+		var resp spdbridge.AddressesBatchResp
+		for _, address := range addresses {
+			if address != "empty" {
+				resp.Addresses = append(resp.Addresses, spdbridge.ExplorerAddress{
+					Address:      address,
+					Transactions: []spdbridge.ExplorerTransaction{{Id: "tx" + address}},
+				})
+			}
+		}
+		return &resp, nil
+	}
+	t.Cleanup(func() {
+		fetchExplorerAddresses = original
+		invalidateExplorerCache(0)
+	})
+	invalidateExplorerCache(0)
+	return &calls
+
+}
+
+func TestExplorerCacheHitsAndInvalidation(t *testing.T) {
+
+	calls := fakeExplorer(t, 0)
+
+	for i := 0; i < 3; i++ {
+		resp, err := GetExplorerAddresses(context.Background(), []string{"a", "b", "empty", "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Addresses) != 2 {
+			t.Fatalf("expected 2 addresses, got %v", len(resp.Addresses))
+		}
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 explorer call, got %v", *calls)
+	}
+
+	_, err := GetExplorerAddresses(context.Background(), []string{"a", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 2 {
+		t.Fatalf("expected 2 explorer calls, got %v", *calls)
+	}
+
+	invalidateExplorerCache(10)
+	_, err = GetExplorerAddresses(context.Background(), []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *calls != 3 {
+		t.Fatalf("expected 3 explorer calls after invalidation, got %v", *calls)
+	}
+
+	stats := GetExplorerCacheStats()
+	if stats.Hits != 7 || stats.Misses != 5 || stats.Height != 10 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+}
+
+func TestExplorerCacheCoalescing(t *testing.T) {
+
+	calls := fakeExplorer(t, 100*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := GetExplorerAddresses(context.Background(), []string{"b", "a"})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if *calls != 1 {
+		t.Fatalf("expected 1 explorer call, got %v", *calls)
+	}
+
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fcmScope         = "https://www.googleapis.com/auth/firebase.messaging"
+	googleTokenUri   = "https://oauth2.googleapis.com/token"
+	jwtBearerGrant   = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	accessTokenLife  = time.Hour
+	accessTokenSlack = time.Minute
+)
+
+type (
+	//serviceAccount holds the fields used of a Google service account key file
+	serviceAccount struct {
+		ProjectId   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenUri    string `json:"token_uri"`
+	}
+
+	//serviceAccountTokens gets OAuth2 access tokens for the service account, signing a JWT with its key, and caches
+	//them until they're about to expire
+	serviceAccountTokens struct {
+		sync.Mutex
+		email    string
+		key      *rsa.PrivateKey
+		tokenUri string
+		client   *http.Client
+
+		token   string
+		expires time.Time
+	}
+
+	accessTokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+)
+
+//loadServiceAccount reads the service account key file at path
+func loadServiceAccount(path string) (*serviceAccount, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var account serviceAccount
+	err = json.Unmarshal(data, &account)
+	if err != nil {
+		return nil, err
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, errors.New("service account file without client_email or private_key")
+	}
+	if account.TokenUri == "" {
+		account.TokenUri = googleTokenUri
+	}
+	return &account, nil
+
+}
+
+func newServiceAccountTokens(account *serviceAccount) (*serviceAccountTokens, error) {
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid service account private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service account private key is not an RSA key")
+	}
+	return &serviceAccountTokens{
+		email:    account.ClientEmail,
+		key:      key,
+		tokenUri: account.TokenUri,
+		client:   &http.Client{Timeout: pushRequestTimeout},
+	}, nil
+
+}
+
+//Token returns a valid access token, requesting a new one when the cached token is missing or expiring
+func (s *serviceAccountTokens) Token(ctx context.Context) (string, error) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.token != "" && time.Now().Add(accessTokenSlack).Before(s.expires) {
+		return s.token, nil
+	}
+
+	assertion, err := s.assertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {jwtBearerGrant}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.tokenUri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != 200 {
+		return "", fmt.Errorf("oauth2 token error %d", response.StatusCode)
+	}
+
+	var resp accessTokenResp
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return "", err
+	}
+	if resp.AccessToken == "" {
+		return "", errors.New("oauth2 token missing")
+	}
+	s.token = resp.AccessToken
+	s.expires = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	return s.token, nil
+
+}
+
+//Invalidate drops the cached token, after it has been rejected
+func (s *serviceAccountTokens) Invalidate() {
+	s.Lock()
+	s.token = ""
+	s.Unlock()
+}
+
+//assertion builds the JWT signed with the service account key which is exchanged for an access token
+func (s *serviceAccountTokens) assertion(now time.Time) (string, error) {
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   s.email,
+		"scope": fcmScope,
+		"aud":   s.tokenUri,
+		"iat":   now.Unix(),
+		"exp":   now.Add(accessTokenLife).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"math/big"
+	"net/http"
+	"scp-app-api/spdbridge"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	//blockSizeLimit is the maximum size of a ScPrime block, used to tell how many blocks the pool takes to clear
+	blockSizeLimit = 2e6
+	blockInterval  = 10 * time.Minute
+
+	//feeConfidence is the share of the observed transactions paying at least the recommended fee which have been
+	//confirmed within the target
+	feeConfidence         = 0.8
+	feeMinObservations    = 10
+	feeMaxObservations    = 2000
+	feeObservedMaxBlocks  = 144
+	feePoolSampleInterval = time.Minute
+	feePoolSamplesMax     = 24 * 60
+	feePoolHistoryLen     = 60
+	feeMaxTransactionSize = 2e6
+)
+
+const (
+	feeLow      = "low"
+	feeNormal   = "normal"
+	feePriority = "priority"
+)
+
+//feeTargets are the confirmation targets, in blocks, of the fee recommendations
+var feeTargets = map[string]uint64{
+	feePriority: 1,
+	feeNormal:   3,
+	feeLow:      6,
+}
+
+//feeObservation is a transaction seen in the pool and then confirmed, or dropped after feeObservedMaxBlocks
+type feeObservation struct {
+	feePerByte *big.Int
+	blocks     uint64
+}
+
+//observedPoolTransaction is a transaction in the pool, waiting to be confirmed
+type observedPoolTransaction struct {
+	feePerByte *big.Int
+	seenHeight uint64
+}
+
+//poolFeeRate is the fee rate and size of a transaction of the last pool snapshot
+type poolFeeRate struct {
+	feePerByte *big.Int
+	size       uint64
+}
+
+var feeEstimator = struct {
+	sync.Mutex
+	observed  map[string]observedPoolTransaction
+	confirmed []feeObservation
+	samples   []FeePoolSample
+	//poolRates are the transactions of the last pool snapshot, highest fee rate first
+	poolRates []poolFeeRate
+	poolSize  uint64
+}{observed: make(map[string]observedPoolTransaction)}
+
+//StartFeeEstimator starts following the pool snapshots and the new blocks, to learn how long transactions paying a
+//given fee rate wait before being confirmed
+func StartFeeEstimator() {
+
+	OnPoolChanged(observePool)
+	OnHeightChanged(func(oldHeight uint64, newHeight uint64) {
+		if oldHeight > 0 {
+			go observeBlocks(oldHeight, newHeight)
+		}
+	})
+
+}
+
+//observePool records the fee rates of the pool and starts waiting for the confirmation of the new transactions
+func observePool(snapshot *transactionPoolSnapshot) {
+
+	if len(snapshot.Ids) != len(snapshot.Transactions) {
+		return
+	}
+	var height uint64
+	if data := networkData; data != nil {
+		height = data.ConsensusHeight
+	}
+
+	var poolRates []poolFeeRate
+	var poolSize uint64
+	for i, transaction := range snapshot.Transactions {
+		rate := poolFeeRate{feePerByte: feePerByte(transaction.MinerFees, snapshot.Sizes[i]), size: snapshot.Sizes[i]}
+		poolRates = append(poolRates, rate)
+		poolSize += rate.size
+	}
+	sort.SliceStable(poolRates, func(i, j int) bool {
+		return poolRates[i].feePerByte.Cmp(poolRates[j].feePerByte) > 0
+	})
+
+	feeEstimator.Lock()
+	defer feeEstimator.Unlock()
+	for i, id := range snapshot.Ids {
+		if _, ok := feeEstimator.observed[id]; !ok {
+			rate := feePerByte(snapshot.Transactions[i].MinerFees, snapshot.Sizes[i])
+			feeEstimator.observed[id] = observedPoolTransaction{feePerByte: rate, seenHeight: height}
+		}
+	}
+	feeEstimator.poolRates = poolRates
+	feeEstimator.poolSize = poolSize
+
+	now := time.Now()
+	samples := feeEstimator.samples
+	if len(samples) == 0 || now.Sub(time.Unix(samples[len(samples)-1].Time, 0)) >= feePoolSampleInterval {
+		sample := FeePoolSample{Time: now.Unix(), Transactions: len(poolRates), Size: poolSize, MedianFeePerByte: "0"}
+		if len(poolRates) > 0 {
+			sample.MedianFeePerByte = poolRates[len(poolRates)/2].feePerByte.String()
+		}
+		samples = append(samples, sample)
+		if len(samples) > feePoolSamplesMax {
+			samples = samples[len(samples)-feePoolSamplesMax:]
+		}
+		feeEstimator.samples = samples
+	}
+
+}
+
+//observeBlocks records how many blocks the observed pool transactions confirmed in the new blocks have waited
+func observeBlocks(oldHeight uint64, newHeight uint64) {
+
+	for height := oldHeight + 1; height <= newHeight; height++ {
+		block, err := spdbridge.GetConsensusBlock(height)
+		if err != nil {
+			fmt.Printf("Error while fetching block %v for fee estimation: %v\n", height, err)
+			return
+		}
+		var ids []string
+		for _, transaction := range block.Transactions {
+			ids = append(ids, transaction.Id)
+		}
+		observeConfirmations(height, ids)
+	}
+
+}
+
+//observeConfirmations records the observed transactions confirmed at height, transactions waiting for more than
+//feeObservedMaxBlocks are recorded as not confirmed
+func observeConfirmations(height uint64, ids []string) {
+
+	feeEstimator.Lock()
+	defer feeEstimator.Unlock()
+
+	for _, id := range ids {
+		observed, ok := feeEstimator.observed[id]
+		if !ok {
+			continue
+		}
+		blocks := uint64(1)
+		if height > observed.seenHeight {
+			blocks = height - observed.seenHeight
+		}
+		feeEstimator.confirmed = append(feeEstimator.confirmed, feeObservation{feePerByte: observed.feePerByte, blocks: blocks})
+		delete(feeEstimator.observed, id)
+	}
+	for id, observed := range feeEstimator.observed {
+		if height > observed.seenHeight+feeObservedMaxBlocks {
+			feeEstimator.confirmed = append(feeEstimator.confirmed, feeObservation{feePerByte: observed.feePerByte, blocks: feeObservedMaxBlocks + 1})
+			delete(feeEstimator.observed, id)
+		}
+	}
+	if len(feeEstimator.confirmed) > feeMaxObservations {
+		feeEstimator.confirmed = feeEstimator.confirmed[len(feeEstimator.confirmed)-feeMaxObservations:]
+	}
+
+}
+
+//getFeesHandler handles requests to /fees
+//Returns low, normal and priority fee per byte recommendations with their confirmation targets. With the size
+//query parameter, in bytes, the response includes the fee of a transaction of that size for each recommendation
+func getFeesHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var size uint64
+	if sizeParam := r.URL.Query().Get("size"); sizeParam != "" {
+		var err error
+		size, err = strconv.ParseUint(sizeParam, 10, 64)
+		if err != nil || size == 0 || size > feeMaxTransactionSize {
+			http.Error(w, failResponse("invalid size"), 400)
+			return
+		}
+	}
+
+	data, err := GetNetworkData()
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	jsonResp, err := json.Marshal(feeRecommendations(data.MinFee, data.MaxFee, size))
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//feeRecommendations combines spd's fee range with the fee rates confirmed within each target and with the fee rates
+//needed to fit in the blocks which the pool would fill
+func feeRecommendations(minFee string, maxFee string, size uint64) FeeEstimateResp {
+
+	min, ok := new(big.Int).SetString(minFee, 10)
+	if !ok {
+		min = new(big.Int)
+	}
+	max, ok := new(big.Int).SetString(maxFee, 10)
+	if !ok || max.Cmp(min) < 0 {
+		max = new(big.Int).Set(min)
+	}
+
+	feeEstimator.Lock()
+	confirmed := append([]feeObservation(nil), feeEstimator.confirmed...)
+	poolRates := feeEstimator.poolRates
+	poolSize := feeEstimator.poolSize
+	history := feeEstimator.samples
+	if len(history) > feePoolHistoryLen {
+		history = history[len(history)-feePoolHistoryLen:]
+	}
+	history = append([]FeePoolSample{}, history...)
+	feeEstimator.Unlock()
+
+	sort.SliceStable(confirmed, func(i, j int) bool {
+		return confirmed[i].feePerByte.Cmp(confirmed[j].feePerByte) > 0
+	})
+
+	//Without enough observations the recommendations are based on spd's fee range
+	defaults := map[string]*big.Int{
+		feeLow:      min,
+		feeNormal:   new(big.Int).Rsh(new(big.Int).Add(min, max), 1),
+		feePriority: max,
+	}
+	rates := make(map[string]*big.Int)
+	for _, level := range []string{feeLow, feeNormal, feePriority} {
+		rate := confirmedFeeRate(confirmed, feeTargets[level])
+		if rate == nil {
+			rate = defaults[level]
+		}
+		if poolRate := poolFeeRateFor(poolRates, feeTargets[level]); poolRate != nil && poolRate.Cmp(rate) > 0 {
+			rate = poolRate
+		}
+		if rate.Cmp(min) < 0 {
+			rate = min
+		}
+		rates[level] = rate
+	}
+	//Faster targets never cost less
+	if rates[feeNormal].Cmp(rates[feeLow]) < 0 {
+		rates[feeNormal] = rates[feeLow]
+	}
+	if rates[feePriority].Cmp(rates[feeNormal]) < 0 {
+		rates[feePriority] = rates[feeNormal]
+	}
+
+	recommendation := func(level string) FeeRecommendation {
+		target := feeTargets[level]
+		recommended := FeeRecommendation{
+			FeePerByte:       rates[level].String(),
+			TargetBlocks:     target,
+			EstimatedMinutes: target * uint64(blockInterval/time.Minute),
+		}
+		if size > 0 {
+			recommended.Fee = new(big.Int).Mul(rates[level], new(big.Int).SetUint64(size)).String()
+		}
+		return recommended
+	}
+
+	return FeeEstimateResp{
+		Low:              recommendation(feeLow),
+		Normal:           recommendation(feeNormal),
+		Priority:         recommendation(feePriority),
+		MinFee:           min.String(),
+		MaxFee:           max.String(),
+		PoolTransactions: len(poolRates),
+		PoolSize:         poolSize,
+		Congested:        poolSize > blockSizeLimit,
+		Observations:     len(confirmed),
+		PoolHistory:      history,
+	}
+
+}
+
+//confirmedFeeRate walks the observations, sorted by decreasing fee rate, in groups of feeMinObservations and returns
+//the lowest fee rate of the last group in which at least feeConfidence of the transactions have been confirmed within
+//target blocks, stopping at the first group which hasn't. Returns nil without enough observations
+func confirmedFeeRate(observations []feeObservation, target uint64) *big.Int {
+
+	var rate *big.Int
+	var count, withinTarget int
+	for _, observation := range observations {
+		count++
+		if observation.blocks <= target {
+			withinTarget++
+		}
+		if count < feeMinObservations {
+			continue
+		}
+		if float64(withinTarget) < feeConfidence*float64(count) {
+			break
+		}
+		rate = observation.feePerByte
+		count, withinTarget = 0, 0
+	}
+	return rate
+
+}
+
+//poolFeeRateFor returns the fee rate needed to outbid the pool transactions which would fill the blocks up to
+//target, or nil if the pool fits in them
+func poolFeeRateFor(poolRates []poolFeeRate, target uint64) *big.Int {
+
+	capacity := target * blockSizeLimit
+	var size uint64
+	for _, rate := range poolRates {
+		size += rate.size
+		if size >= capacity {
+			return new(big.Int).Add(rate.feePerByte, big.NewInt(1))
+		}
+	}
+	return nil
+
+}
+
+//feePerByte returns the miner fees of a transaction divided by its size
+func feePerByte(minerFees []string, size uint64) *big.Int {
+	total := new(big.Int)
+	for _, fee := range minerFees {
+		if value, ok := new(big.Int).SetString(fee, 10); ok {
+			total.Add(total, value)
+		}
+	}
+	if size == 0 {
+		return total
+	}
+	return total.Quo(total, new(big.Int).SetUint64(size))
+}
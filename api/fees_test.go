@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math/big"
+	"scp-app-api/spdbridge"
+	"strconv"
+	"testing"
+)
+
+func resetFeeEstimator() {
+	feeEstimator.Lock()
+	feeEstimator.observed = make(map[string]observedPoolTransaction)
+	feeEstimator.confirmed = nil
+	feeEstimator.samples = nil
+	feeEstimator.poolRates = nil
+	feeEstimator.poolSize = 0
+	feeEstimator.Unlock()
+}
+
+func TestFeeRecommendations(t *testing.T) {
+
+	resetFeeEstimator()
+	defer resetFeeEstimator()
+	originalData := networkData
+	defer func() { networkData = originalData }()
+	networkData = &NetworkData{ConsensusHeight: 100}
+
+	//Without observations the recommendations follow spd's fee range
+	resp := feeRecommendations("10", "30", 0)
+	if resp.Low.FeePerByte != "10" || resp.Normal.FeePerByte != "20" || resp.Priority.FeePerByte != "30" || resp.Low.Fee != "" {
+		t.Fatalf("unexpected recommendations %+v", resp)
+	}
+
+	//Transactions paying 50 per byte are confirmed in the next block, the ones paying 15 after 4 blocks
+	var snapshot spdbridge.TransactionPoolResp
+	var fast, slow []string
+	for i := 0; i < 20; i++ {
+		id := strconv.Itoa(i)
+		fee := "15000"
+		if i%2 == 0 {
+			fee = "50000"
+			fast = append(fast, id)
+		} else {
+			slow = append(slow, id)
+		}
+		snapshot.Transactions = append(snapshot.Transactions, spdbridge.RawTransaction{MinerFees: []string{fee}})
+		snapshot.Ids = append(snapshot.Ids, id)
+		snapshot.Sizes = append(snapshot.Sizes, 1000)
+	}
+	observePool(newTransactionPoolSnapshot(&snapshot))
+	observeConfirmations(101, fast)
+	observeConfirmations(104, slow)
+
+	resp = feeRecommendations("10", "30", 250)
+	if resp.Observations != 20 || len(resp.PoolHistory) != 1 || resp.PoolHistory[0].Transactions != 20 || resp.PoolHistory[0].Size != 20000 {
+		t.Fatalf("unexpected estimator state %+v", resp)
+	}
+	if resp.Priority.FeePerByte != "50" || resp.Normal.FeePerByte != "50" || resp.Low.FeePerByte != "15" {
+		t.Fatalf("unexpected recommendations %+v", resp)
+	}
+	if resp.Low.Fee != "3750" || resp.Priority.TargetBlocks != 1 || resp.Low.EstimatedMinutes != 60 {
+		t.Fatalf("unexpected recommendations %+v", resp)
+	}
+	if resp.Congested {
+		t.Fatal("expected the pool not to be congested")
+	}
+
+}
+
+func TestPoolFeeRate(t *testing.T) {
+
+	//Three blocks worth of transactions paying 100 per byte, then some paying 10
+	var poolRates []poolFeeRate
+	for i := 0; i < 3; i++ {
+		poolRates = append(poolRates, poolFeeRate{feePerByte: big.NewInt(100), size: blockSizeLimit})
+	}
+	poolRates = append(poolRates, poolFeeRate{feePerByte: big.NewInt(10), size: 1000})
+
+	if rate := poolFeeRateFor(poolRates, 1); rate == nil || rate.String() != "101" {
+		t.Fatalf("expected to outbid the first block, got %v", rate)
+	}
+	if rate := poolFeeRateFor(poolRates, 6); rate != nil {
+		t.Fatalf("expected the pool to fit in 6 blocks, got %v", rate)
+	}
+
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+const idempotencyMaxKeyLen = 255
+
+const (
+	//idempotencyMaxKeys caps the results kept, new keys are refused until expired ones are swept
+	idempotencyMaxKeys       = 100000
+	idempotencySweepInterval = time.Minute
+)
+
+//idempotencyWindow is how long the result of a request is kept for its retries, set with -idempotencywindow
+var idempotencyWindow = 24 * time.Hour
+
+//idempotentResult is the result of a request carrying an idempotency key. done is closed once the result is available
+type idempotentResult struct {
+	requestHash [sha256.Size]byte
+	done        chan struct{}
+	statusCode  int
+	body        string
+	expiresAt   time.Time
+}
+
+var idempotentResults = struct {
+	sync.Mutex
+	results map[string]*idempotentResult
+}{results: make(map[string]*idempotentResult)}
+
+//idempotentRequest runs handle once for each key within idempotencyWindow: retries get the result of the first
+//request, waiting for it if it's still running. Server errors are not kept, so that the request can be retried
+func idempotentRequest(key string, request []byte, handle func() (int, string)) (int, string) {
+
+	if len(key) > idempotencyMaxKeyLen {
+		return 400, failResponse("idempotency key too long")
+	}
+	requestHash := sha256.Sum256(request)
+
+	idempotentResults.Lock()
+	result, ok := idempotentResults.results[key]
+	//Expired results not swept yet are replaced
+	if ok && result.expired(time.Now()) {
+		ok = false
+	}
+	if !ok {
+		if len(idempotentResults.results) >= idempotencyMaxKeys {
+			idempotentResults.Unlock()
+			return 503, failResponse("too many idempotency keys in use, retry later")
+		}
+		result = &idempotentResult{requestHash: requestHash, done: make(chan struct{})}
+		idempotentResults.results[key] = result
+	}
+	idempotentResults.Unlock()
+
+	if ok {
+		if result.requestHash != requestHash {
+			return 422, failResponse("idempotency key already used for a different request")
+		}
+		<-result.done
+		return result.statusCode, result.body
+	}
+
+	result.statusCode, result.body = handle()
+	idempotentResults.Lock()
+	if result.statusCode >= 500 {
+		delete(idempotentResults.results, key)
+	} else {
+		result.expiresAt = time.Now().Add(idempotencyWindow)
+	}
+	idempotentResults.Unlock()
+	close(result.done)
+
+	return result.statusCode, result.body
+
+}
+
+//StartIdempotencySweep starts removing the expired results periodically
+func StartIdempotencySweep() {
+	go syncIdempotentResults()
+}
+
+func syncIdempotentResults() {
+
+	sweepIdempotentResults(time.Now())
+
+	time.Sleep(idempotencySweepInterval)
+	go syncIdempotentResults()
+
+}
+
+//sweepIdempotentResults removes the results expired at now
+func sweepIdempotentResults(now time.Time) {
+
+	idempotentResults.Lock()
+	defer idempotentResults.Unlock()
+
+	for key, result := range idempotentResults.results {
+		if result.expired(now) {
+			delete(idempotentResults.results, key)
+		}
+	}
+
+}
+
+//expired tells whether the result is past its window at now, results of running requests never expire
+func (result *idempotentResult) expired(now time.Time) bool {
+	return !result.expiresAt.IsZero() && now.After(result.expiresAt)
+}
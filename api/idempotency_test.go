@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"scp-app-api/spdbridge"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdempotentTransaction(t *testing.T) {
+
+	dataDir = t.TempDir()
+
+	accepted := spdbridge.Transaction{ArbitraryData: [][]byte{[]byte("accepted")}}
+	inPool := spdbridge.Transaction{ArbitraryData: [][]byte{[]byte("in pool")}}
+	inPoolId, _ := inPool.Id()
+	acceptedJSON, _ := json.Marshal(accepted)
+	inPoolJSON, _ := json.Marshal(inPool)
+
+	var mutex sync.Mutex
+	broadcastCount := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/consensus/validate/transactionset", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/tpool/raw/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/tpool/raw/") != inPoolId {
+			http.Error(w, "transaction not found in transaction pool", 400)
+			return
+		}
+		json.NewEncoder(w).Encode(spdbridge.TransactionPoolRawResp{Id: inPoolId})
+	})
+	mux.HandleFunc("/tpool/confirmed/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(spdbridge.TransactionPoolConfirmedResp{})
+	})
+	mux.HandleFunc("/tpool/raw", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("transaction") == string(inPoolJSON) {
+			http.Error(w, "transaction set already in the pool", 400)
+			return
+		}
+		mutex.Lock()
+		broadcastCount++
+		mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	fakeSpd(t, mux)
+
+	submit := func(key string, transaction []byte) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(NewTransactionParams{
+			ValidateData:  "[" + string(transaction) + "]",
+			BroadcastData: BroadcastData{Parents: "[]", Transaction: string(transaction)},
+		})
+		request := httptest.NewRequest("POST", "/v1/transactions", strings.NewReader(string(body)))
+		if key != "" {
+			request.Header.Set(idempotencyKeyHeader, key)
+		}
+		recorder := httptest.NewRecorder()
+		newTransactionHandler(recorder, request, nil)
+		return recorder
+	}
+
+	for i := 0; i < 2; i++ {
+		if recorder := submit("retried", acceptedJSON); recorder.Code != 200 {
+			t.Fatalf("expected status 200, got %v %v", recorder.Code, recorder.Body.String())
+		}
+	}
+	mutex.Lock()
+	if broadcastCount != 1 {
+		t.Fatalf("expected a single broadcast, got %v", broadcastCount)
+	}
+	mutex.Unlock()
+
+	if recorder := submit("retried", inPoolJSON); recorder.Code != 422 {
+		t.Fatalf("expected status 422 reusing a key, got %v", recorder.Code)
+	}
+	if recorder := submit(strings.Repeat("k", idempotencyMaxKeyLen+1), acceptedJSON); recorder.Code != 400 {
+		t.Fatalf("expected status 400 for a long key, got %v", recorder.Code)
+	}
+
+	//spd rejects the set because it already has it, which is a success for the client
+	if recorder := submit("", inPoolJSON); recorder.Code != 200 {
+		t.Fatalf("expected status 200 for a transaction in the pool, got %v %v", recorder.Code, recorder.Body.String())
+	}
+
+}
+
+func TestIdempotentResultsLimits(t *testing.T) {
+
+	defer func() {
+		idempotentResults.Lock()
+		idempotentResults.results = make(map[string]*idempotentResult)
+		idempotentResults.Unlock()
+	}()
+	handle := func() (int, string) {
+		return 200, "handled"
+	}
+
+	idempotentRequest("old", []byte("request"), handle)
+	idempotentResults.Lock()
+	idempotentResults.results["old"].expiresAt = time.Now().Add(-time.Second)
+	idempotentResults.Unlock()
+	//An expired key not swept yet is reused for a new request
+	if statusCode, _ := idempotentRequest("old", []byte("other request"), handle); statusCode != 200 {
+		t.Fatalf("expected the expired key to be reusable, got %v", statusCode)
+	}
+
+	idempotentResults.Lock()
+	idempotentResults.results["expired"] = &idempotentResult{expiresAt: time.Now().Add(-time.Second)}
+	idempotentResults.Unlock()
+	sweepIdempotentResults(time.Now())
+	idempotentResults.Lock()
+	_, expired := idempotentResults.results["expired"]
+	_, current := idempotentResults.results["old"]
+	idempotentResults.Unlock()
+	if expired || !current {
+		t.Fatal("expected only the expired result to be swept")
+	}
+
+	idempotentResults.Lock()
+	for i := len(idempotentResults.results); i < idempotencyMaxKeys; i++ {
+		idempotentResults.results[strconv.Itoa(i)] = &idempotentResult{expiresAt: time.Now().Add(time.Hour)}
+	}
+	idempotentResults.Unlock()
+	if statusCode, _ := idempotentRequest("new", []byte("request"), handle); statusCode != 503 {
+		t.Fatalf("expected new keys to be refused once idempotencyMaxKeys is reached, got %v", statusCode)
+	}
+
+}
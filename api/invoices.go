@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"scp-app-api/spdbridge"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const invoicesFile = "invoices.json"
+
+const (
+	invoiceDefaultExpiry        = time.Hour
+	invoiceMaxExpiry            = 30 * 24 * time.Hour
+	invoiceDefaultConfirmations = 1
+	invoiceMaxConfirmations     = 144
+)
+
+const (
+	//invoiceRetention is how long an invoice is kept after its expiry, its status can't be queried afterwards
+	invoiceRetention     = 30 * 24 * time.Hour
+	invoicePruneInterval = time.Hour
+	//invoicesMax caps the invoices stored, since every creation rewrites invoicesFile
+	invoicesMax = 10000
+)
+
+const (
+	invoiceUnpaid    = "unpaid"
+	invoicePending   = "pending"
+	invoiceUnderpaid = "underpaid"
+	invoicePaid      = "paid"
+	invoiceOverpaid  = "overpaid"
+	invoiceExpired   = "expired"
+)
+
+//hastingsPerScp is the number of hastings, the smallest unit, in one SCP
+var hastingsPerScp = new(big.Int).Exp(big.NewInt(10), big.NewInt(27), nil)
+
+//invoice is a payment request for an address, invoices are persisted in invoicesFile
+type invoice struct {
+	Id            string `json:"id"`
+	Address       string `json:"address"`
+	Amount        string `json:"amount"`
+	FiatAmount    string `json:"fiatAmount,omitempty"`
+	Currency      string `json:"currency"`
+	ExchangeRate  string `json:"exchangeRate,omitempty"`
+	CreatedAt     int64  `json:"createdAt"`
+	ExpiresAt     int64  `json:"expiresAt"`
+	CreatedHeight uint64 `json:"createdHeight"`
+	Confirmations uint64 `json:"confirmations"`
+}
+
+var invoices = struct {
+	sync.Mutex
+	invoices map[string]*invoice
+}{invoices: make(map[string]*invoice)}
+
+//LoadInvoices loads the invoices persisted in the data directory
+func LoadInvoices() {
+
+	var stored map[string]*invoice
+	err := loadJSON(invoicesFile, &stored)
+	if err != nil {
+		fmt.Printf("Error while loading invoices: %v\n", err)
+	}
+	invoices.Lock()
+	for id, inv := range stored {
+		invoices.invoices[id] = inv
+	}
+	invoices.Unlock()
+
+}
+
+//StartInvoices loads the invoices and starts pruning the ones past their retention
+func StartInvoices() {
+
+	LoadInvoices()
+	go syncInvoices()
+
+}
+
+func syncInvoices() {
+
+	pruneInvoices(time.Now())
+
+	time.Sleep(invoicePruneInterval)
+	go syncInvoices()
+
+}
+
+//pruneInvoices removes the invoices expired for longer than invoiceRetention at now
+func pruneInvoices(now time.Time) {
+
+	invoices.Lock()
+	defer invoices.Unlock()
+
+	pruned := false
+	for id, inv := range invoices.invoices {
+		if now.After(time.Unix(inv.ExpiresAt, 0).Add(invoiceRetention)) {
+			delete(invoices.invoices, id)
+			pruned = true
+		}
+	}
+	if pruned {
+		err := saveInvoices()
+		if err != nil {
+			fmt.Printf("Error while saving invoices: %v\n", err)
+		}
+	}
+
+}
+
+//newInvoiceHandler handles requests to /invoices
+//Creates an invoice for the address. The amount is in SCP, or in one of the supported fiat currencies
+//converted to SCP with the current exchange rate
+func newInvoiceHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+
+	var params InvoiceParams
+	err = json.Unmarshal(body, &params)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+
+	if spdbridge.ValidateAddress(params.Address) != nil {
+		http.Error(w, failResponse("invalid address"), 400)
+		return
+	}
+	//ExpiresIn is checked before converting it, so that a large value can't overflow the duration
+	if params.ExpiresIn < 0 || params.ExpiresIn > int64(invoiceMaxExpiry/time.Second) {
+		http.Error(w, failResponse("invalid expiry"), 400)
+		return
+	}
+	expiresIn := invoiceDefaultExpiry
+	if params.ExpiresIn != 0 {
+		expiresIn = time.Duration(params.ExpiresIn) * time.Second
+	}
+	confirmations := uint64(invoiceDefaultConfirmations)
+	if params.Confirmations != nil {
+		confirmations = *params.Confirmations
+	}
+	if confirmations > invoiceMaxConfirmations {
+		http.Error(w, failResponse(fmt.Sprintf("at most %d confirmations can be required", invoiceMaxConfirmations)), 400)
+		return
+	}
+
+	networkData, err := GetNetworkData()
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	now := time.Now()
+	inv := invoice{
+		Id:            randomId(),
+		Address:       params.Address,
+		Currency:      strings.ToUpper(params.Currency),
+		CreatedAt:     now.Unix(),
+		ExpiresAt:     now.Add(expiresIn).Unix(),
+		CreatedHeight: networkData.ConsensusHeight,
+		Confirmations: confirmations,
+	}
+	if inv.Currency == "" {
+		inv.Currency = "SCP"
+	}
+
+	hastings, price, err := scpAmount(params.Amount, inv.Currency)
+	if err != nil {
+		http.Error(w, failResponse(err.Error()), 400)
+		return
+	}
+	inv.Amount = hastings.String()
+	if price != nil {
+		inv.FiatAmount = params.Amount
+		inv.ExchangeRate = price.FloatString(12)
+	}
+
+	invoices.Lock()
+	if len(invoices.invoices) >= invoicesMax {
+		invoices.Unlock()
+		http.Error(w, failResponse("too many invoices"), 503)
+		return
+	}
+	invoices.invoices[inv.Id] = &inv
+	err = saveInvoices()
+	invoices.Unlock()
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	jsonResp, err := json.Marshal(inv.state(nil, nil, networkData.ConsensusHeight, now.Unix()))
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//getInvoiceHandler handles requests to /invoices/:id
+//Returns the invoice with its state, computed from the transaction pool and the explorer
+func getInvoiceHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	invoices.Lock()
+	stored, ok := invoices.invoices[ps.ByName("id")]
+	var inv invoice
+	if ok {
+		inv = *stored
+	}
+	invoices.Unlock()
+	if !ok {
+		http.Error(w, standardFailResponse, 404)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), batchRequestTimeout)
+	defer cancel()
+
+	networkData, err := GetNetworkData()
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+	explorerAddresses, pool, err := GetAddressesAndPool(ctx, []string{inv.Address})
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	var confirmed []spdbridge.ExplorerTransaction
+	for _, explorerAddress := range explorerAddresses.Addresses {
+		if explorerAddress.Address == inv.Address {
+			confirmed = explorerAddress.Transactions
+		}
+	}
+	unconfirmed := pool.relatedTransactions([]string{inv.Address}, nil)
+
+	jsonResp, err := json.Marshal(inv.state(confirmed, unconfirmed, networkData.ConsensusHeight, time.Now().Unix()))
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//state computes the state of the invoice at the consensus height and time provided. Only payments confirmed
+//after the invoice creation, in blocks mined before its expiry, are counted. Unconfirmed payments are counted
+//until the invoice expires
+func (inv *invoice) state(confirmed []spdbridge.ExplorerTransaction, unconfirmed []spdbridge.RawTransaction, height uint64, now int64) InvoiceResp {
+
+	resp := InvoiceResp{
+		Id:                    inv.Id,
+		Address:               inv.Address,
+		Amount:                inv.Amount,
+		FiatAmount:            inv.FiatAmount,
+		Currency:              inv.Currency,
+		ExchangeRate:          inv.ExchangeRate,
+		CreatedAt:             inv.CreatedAt,
+		ExpiresAt:             inv.ExpiresAt,
+		RequiredConfirmations: inv.Confirmations,
+		Transactions:          []InvoiceTransaction{},
+	}
+	received, pending := new(big.Int), new(big.Int)
+
+	seenIds := make(map[string]struct{})
+	for _, explorerTransaction := range confirmed {
+		if explorerTransaction.Height <= inv.CreatedHeight || explorerTransaction.BlockTimestamp > uint64(inv.ExpiresAt) {
+			continue
+		}
+		if _, ok := seenIds[explorerTransaction.Id]; ok {
+			continue
+		}
+		seenIds[explorerTransaction.Id] = struct{}{}
+		paid := paidTo(explorerTransaction.RawTransaction, inv.Address)
+		if paid.Sign() == 0 {
+			continue
+		}
+		var confirmations uint64
+		if height >= explorerTransaction.Height {
+			confirmations = height - explorerTransaction.Height + 1
+		}
+		if confirmations >= inv.Confirmations {
+			received.Add(received, paid)
+		} else {
+			pending.Add(pending, paid)
+		}
+		resp.Transactions = append(resp.Transactions, InvoiceTransaction{
+			Id:            explorerTransaction.Id,
+			Amount:        paid.String(),
+			Height:        explorerTransaction.Height,
+			Confirmations: confirmations,
+		})
+	}
+
+	expired := now > inv.ExpiresAt
+	if !expired {
+		for _, transaction := range unconfirmed {
+			paid := paidTo(transaction, inv.Address)
+			if paid.Sign() == 0 {
+				continue
+			}
+			if inv.Confirmations == 0 {
+				received.Add(received, paid)
+			} else {
+				pending.Add(pending, paid)
+			}
+			resp.Transactions = append(resp.Transactions, InvoiceTransaction{Amount: paid.String()})
+		}
+	}
+
+	amount, _ := new(big.Int).SetString(inv.Amount, 10)
+	total := new(big.Int).Add(received, pending)
+	switch {
+	case received.Cmp(amount) > 0:
+		resp.Status = invoiceOverpaid
+	case received.Cmp(amount) == 0:
+		resp.Status = invoicePaid
+	case total.Cmp(amount) >= 0:
+		resp.Status = invoicePending
+	case expired:
+		resp.Status = invoiceExpired
+	case total.Sign() > 0:
+		resp.Status = invoiceUnderpaid
+	default:
+		resp.Status = invoiceUnpaid
+	}
+	resp.Received = received.String()
+	resp.Pending = pending.String()
+	return resp
+
+}
+
+//paidTo returns the hastings the transaction sends to the address
+func paidTo(transaction spdbridge.RawTransaction, address string) *big.Int {
+	paid := new(big.Int)
+	for _, output := range transaction.ScpOutputs {
+		if output.UnlockHash != address {
+			continue
+		}
+		if value, ok := new(big.Int).SetString(output.Value, 10); ok {
+			paid.Add(paid, value)
+		}
+	}
+	return paid
+}
+
+//scpAmount converts the decimal amount in the currency provided, SCP or fiat, to hastings. For fiat
+//amounts the price of one SCP in that currency is returned too
+func scpAmount(amount string, currency string) (hastings *big.Int, price *big.Rat, err error) {
+
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok || value.Sign() <= 0 {
+		return nil, nil, errors.New("invalid amount")
+	}
+	if currency != "SCP" {
+		price, err = scpFiatPrice(currency)
+		if err != nil {
+			return nil, nil, err
+		}
+		value.Quo(value, price)
+	}
+
+	hastings = new(big.Int).Quo(new(big.Int).Mul(value.Num(), hastingsPerScp), value.Denom())
+	if hastings.Sign() <= 0 {
+		return nil, nil, errors.New("invalid amount")
+	}
+	return hastings, price, nil
+
+}
+
+//scpFiatPrice returns the price of one SCP in the currency provided, from the cached USD quote and exchange rates
+func scpFiatPrice(currency string) (*big.Rat, error) {
+
+	usd, err := GetFiatPrice()
+	if err != nil || usd == nil || *usd <= 0 {
+		return nil, fmt.Errorf("SCP price not available")
+	}
+	price := ratFromFloat(*usd)
+	if currency == "USD" {
+		return price, nil
+	}
+
+	rates, err := GetUsdExchangeRates()
+	if err != nil || rates == nil {
+		return nil, fmt.Errorf("exchange rates not available")
+	}
+	rate, ok := (*rates)[currency]
+	if !ok || rate <= 0 {
+		return nil, fmt.Errorf("unsupported currency %v", currency)
+	}
+	return price.Mul(price, ratFromFloat(rate)), nil
+
+}
+
+//ratFromFloat converts the float using its shortest decimal representation, so that 0.01 is exactly 1/100
+func ratFromFloat(value float64) *big.Rat {
+	rat, _ := new(big.Rat).SetString(strconv.FormatFloat(value, 'f', -1, 64))
+	return rat
+}
+
+//saveInvoices persists the invoices, must be called holding the invoices lock
+func saveInvoices() error {
+	return saveJSON(invoicesFile, invoices.invoices)
+}
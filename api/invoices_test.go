@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"scp-app-api/spdbridge"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInvoiceState(t *testing.T) {
+
+	inv := invoice{Address: testAddress, Amount: "100", CreatedHeight: 10, ExpiresAt: 1000, Confirmations: 2}
+	payment := func(value string, height uint64, timestamp uint64) spdbridge.ExplorerTransaction {
+		return spdbridge.ExplorerTransaction{
+			RawTransaction: spdbridge.RawTransaction{ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: testAddress, Value: value}}},
+			Id:             value + "-" + string(rune('a'+height)),
+			Height:         height,
+			BlockTimestamp: timestamp,
+		}
+	}
+	unconfirmed := func(value string) spdbridge.RawTransaction {
+		return spdbridge.RawTransaction{ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: testAddress, Value: value}}}
+	}
+
+	tests := []struct {
+		name        string
+		confirmed   []spdbridge.ExplorerTransaction
+		unconfirmed []spdbridge.RawTransaction
+		height      uint64
+		now         int64
+		status      string
+		received    string
+		pending     string
+	}{
+		{"unpaid", nil, nil, 11, 500, invoiceUnpaid, "0", "0"},
+		{"payment before creation", []spdbridge.ExplorerTransaction{payment("100", 10, 100)}, nil, 11, 500, invoiceUnpaid, "0", "0"},
+		{"pending in pool", nil, []spdbridge.RawTransaction{unconfirmed("100")}, 11, 500, invoicePending, "0", "100"},
+		{"not enough confirmations", []spdbridge.ExplorerTransaction{payment("100", 11, 100)}, nil, 11, 500, invoicePending, "0", "100"},
+		{"underpaid", []spdbridge.ExplorerTransaction{payment("40", 11, 100)}, []spdbridge.RawTransaction{unconfirmed("10")}, 12, 500, invoiceUnderpaid, "40", "10"},
+		{"paid in two payments", []spdbridge.ExplorerTransaction{payment("40", 11, 100), payment("60", 12, 200)}, nil, 13, 500, invoicePaid, "100", "0"},
+		{"overpaid", []spdbridge.ExplorerTransaction{payment("150", 11, 100)}, nil, 12, 500, invoiceOverpaid, "150", "0"},
+		{"expired", nil, []spdbridge.RawTransaction{unconfirmed("100")}, 20, 1001, invoiceExpired, "0", "0"},
+		{"paid after expiry", []spdbridge.ExplorerTransaction{payment("100", 15, 1100)}, nil, 20, 1200, invoiceExpired, "0", "0"},
+		{"paid before expiry", []spdbridge.ExplorerTransaction{payment("100", 15, 900)}, nil, 20, 1200, invoicePaid, "100", "0"},
+	}
+	for _, test := range tests {
+		state := inv.state(test.confirmed, test.unconfirmed, test.height, test.now)
+		if state.Status != test.status || state.Received != test.received || state.Pending != test.pending {
+			t.Errorf("%v: got status %v received %v pending %v", test.name, state.Status, state.Received, state.Pending)
+		}
+	}
+
+}
+
+func TestNewFiatInvoice(t *testing.T) {
+
+	dataDir = t.TempDir()
+	price := 0.01
+	networkData = &NetworkData{ConsensusHeight: 1}
+	usdPrice = &price
+	exchangeRates = &map[string]float64{"EUR": 0.5}
+
+	server := httptest.NewServer(buildRouter())
+	defer server.Close()
+
+	params, _ := json.Marshal(InvoiceParams{Address: testAddress, Amount: "10", Currency: "eur"})
+	resp, err := http.Post(server.URL+"/v1/invoices", "application/json", bytes.NewReader(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inv InvoiceResp
+	json.NewDecoder(resp.Body).Decode(&inv)
+	resp.Body.Close()
+	//10 EUR at 0.005 EUR per SCP
+	if resp.StatusCode != 200 || inv.Amount != "2000000000000000000000000000000" || inv.Currency != "EUR" || inv.Status != invoiceUnpaid {
+		t.Fatalf("unexpected invoice %v %+v", resp.StatusCode, inv)
+	}
+
+	params, _ = json.Marshal(InvoiceParams{Address: testAddress, Amount: "10", Currency: "XYZ"})
+	resp, err = http.Post(server.URL+"/v1/invoices", "application/json", bytes.NewReader(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Fatalf("expected unsupported currencies to be rejected, got %v", resp.StatusCode)
+	}
+
+	invoices.Lock()
+	invoices.invoices = make(map[string]*invoice)
+	invoices.Unlock()
+	LoadInvoices()
+	invoices.Lock()
+	_, ok := invoices.invoices[inv.Id]
+	invoices.Unlock()
+	if !ok {
+		t.Fatal("invoice not persisted")
+	}
+
+	//An expiry overflowing a duration once converted must be rejected, not wrap around
+	for _, expiresIn := range []int64{-1, 30*24*3600 + 1, 1 << 62} {
+		params, _ = json.Marshal(InvoiceParams{Address: testAddress, Amount: "10", ExpiresIn: expiresIn})
+		resp, err = http.Post(server.URL+"/v1/invoices", "application/json", bytes.NewReader(params))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 400 {
+			t.Fatalf("expected expiresIn %v to be rejected, got %v", expiresIn, resp.StatusCode)
+		}
+	}
+
+}
+
+func TestPruneInvoices(t *testing.T) {
+
+	dataDir = t.TempDir()
+	networkData = &NetworkData{ConsensusHeight: 1}
+	now := time.Now()
+	invoices.Lock()
+	invoices.invoices = map[string]*invoice{
+		"old":    {Id: "old", ExpiresAt: now.Add(-invoiceRetention - time.Hour).Unix()},
+		"recent": {Id: "recent", ExpiresAt: now.Add(-time.Hour).Unix()},
+	}
+	invoices.Unlock()
+
+	pruneInvoices(now)
+	invoices.Lock()
+	_, old := invoices.invoices["old"]
+	_, recent := invoices.invoices["recent"]
+	invoices.Unlock()
+	if old || !recent {
+		t.Fatalf("expected only the invoice past its retention to be pruned, got %v", invoices.invoices)
+	}
+
+	invoices.Lock()
+	for i := len(invoices.invoices); i < invoicesMax; i++ {
+		id := strconv.Itoa(i)
+		invoices.invoices[id] = &invoice{Id: id, ExpiresAt: now.Unix()}
+	}
+	invoices.Unlock()
+	params, _ := json.Marshal(InvoiceParams{Address: testAddress, Amount: "10"})
+	recorder := httptest.NewRecorder()
+	newInvoiceHandler(recorder, httptest.NewRequest("POST", "/v1/invoices", bytes.NewReader(params)), nil)
+	if recorder.Code != 503 {
+		t.Fatalf("expected the creation to fail once invoicesMax is reached, got %v", recorder.Code)
+	}
+
+	invoices.Lock()
+	invoices.invoices = make(map[string]*invoice)
+	invoices.Unlock()
+
+}
@@ -1,10 +1,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"scp-app-api/spdbridge"
 )
 
@@ -12,19 +12,39 @@ const verbose = false
 
 var port = "14280"
 
+var useLocalIndex = false
+var dataDir = "."
+var fcmServiceAccount = ""
+var fcmProjectId = ""
+
 func main() {
 
+	parseArguments()
+
 	if !checkSpd() {
 
-		//TODO improve arguments parsing
 		log.Fatal("spd daemon connection failed, check that:\n" +
 			"- spd API is running at " + spdbridge.SpdApiURL + ":" + spdbridge.SpdApiPort + "\n" +
 			"- spd consensus module is synced\n" +
-			"- spd explorer module is loaded\n" +
+			"- spd explorer module is loaded, or -localindex is used\n" +
 			"- spd transaction pool module is loaded\n" +
-			"- spd.patch has been applied\n" +
-			"Command example: ./scpwalletapi [coinmarketcap api key] [getgeoapi.com api key] [spd api port] [spd api password] [custom port]")
+			"Command example: ./scpwalletapi [-localindex] [-datadir path] [-fcmcredentials file] [-fcmproject id] [coinmarketcap api key] [getgeoapi.com api key] [spd api port] [spd api password] [custom port]")
+
+	}
+
+	if useLocalIndex {
+		err := StartAddressIndex(dataDir)
+		if err != nil {
+			log.Fatalf("Address index could not be opened: %v", err)
+		}
+	}
 
+	if fcmServiceAccount != "" {
+		fcm, err := newFcmNotifier(fcmServiceAccount, fcmProjectId)
+		if err != nil {
+			log.Fatalf("Firebase Cloud Messaging could not be set up: %v", err)
+		}
+		notifier = fcm
 	}
 
 	StartDataSync()
@@ -34,29 +54,42 @@ func main() {
 
 }
 
-//Checks if we can connect to spd
-func checkSpd() bool {
+//parseArguments reads the optional flags followed by the positional arguments
+func parseArguments() {
 
-	if len(os.Args) > 1 {
-		CMCApiKey = os.Args[1]
-		if len(os.Args) > 2 {
-			GetGeoApiKey = os.Args[2]
+	flag.BoolVar(&useLocalIndex, "localindex", useLocalIndex, "build a local address index instead of using the spd explorer")
+	flag.StringVar(&dataDir, "datadir", dataDir, "directory where the persistent data is stored")
+	flag.StringVar(&fcmServiceAccount, "fcmcredentials", fcmServiceAccount, "Firebase service account key file, enables push notifications")
+	flag.StringVar(&fcmProjectId, "fcmproject", fcmProjectId, "Firebase project id, defaults to the project of the service account")
+	flag.DurationVar(&idempotencyWindow, "idempotencywindow", idempotencyWindow, "how long transaction submissions are remembered for requests carrying an Idempotency-Key header")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) > 0 {
+		CMCApiKey = args[0]
+		if len(args) > 1 {
+			GetGeoApiKey = args[1]
 		} else if GetGeoApiKey == "" {
 			fmt.Println("No getgeoapi API KEY provided, only USD quotes will be available to clients.")
 		}
 	} else if CMCApiKey == "" {
 		fmt.Println("No coinmarketcap API KEY provided, usd quotes will not be available to clients.")
 	}
-	if len(os.Args) > 3 {
-		spdbridge.SpdApiPort = os.Args[3]
+	if len(args) > 2 {
+		spdbridge.SpdApiPort = args[2]
 	}
-	if len(os.Args) > 4 {
-		spdbridge.SpdApiPassword = os.Args[4]
+	if len(args) > 3 {
+		spdbridge.SpdApiPassword = args[3]
 	}
-	if len(os.Args) > 5 {
-		port = os.Args[5]
+	if len(args) > 4 {
+		port = args[4]
 	}
 
+}
+
+//Checks if we can connect to spd
+func checkSpd() bool {
+
 	consensus, err := spdbridge.GetConsensus()
 	if err != nil {
 		fmt.Printf("Test call to consensus failed with error: %v\n\n", err)
@@ -70,10 +103,18 @@ func checkSpd() bool {
 		fmt.Printf("Test call to transaction pool failed with error: %v\n\n", err)
 		return false
 	}
-	_, err = spdbridge.ExplorerAddressesBatch([]string{})
-	if err != nil {
-		fmt.Printf("Test call to explorer failed with error: %v\n\n", err)
-		return false
+	if useLocalIndex {
+		_, err = spdbridge.GetConsensusBlock(consensus.Height)
+		if err != nil {
+			fmt.Printf("Test call to consensus blocks failed with error: %v\n\n", err)
+			return false
+		}
+	} else {
+		_, err = spdbridge.ExplorerAddressesBatch([]string{})
+		if err != nil {
+			fmt.Printf("Test call to explorer failed with error: %v\n\n", err)
+			return false
+		}
 	}
 
 	return true
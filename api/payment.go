@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"github.com/skip2/go-qrcode"
+	"net/http"
+	"net/url"
+	"scp-app-api/spdbridge"
+	"strconv"
+	"strings"
+)
+
+const paymentUriScheme = "scprime"
+
+const (
+	qrDefaultSize = 256
+	qrMinSize     = 64
+	qrMaxSize     = 1024
+)
+
+//paymentUriHandler handles requests to /payment/uri
+//Validates the payment request in the query (address, amount, currency, label and message) and returns its scprime: URI
+func paymentUriHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	resp, err := newPaymentRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, failResponse(err.Error()), 400)
+		return
+	}
+
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//paymentQrHandler handles requests to /payment/qr
+//Renders the scprime: URI of the payment request in the query as a QR code, in the format
+//requested: png (default) or svg. The size in pixels of png images can be set with size
+func paymentQrHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+
+	query := r.URL.Query()
+	resp, err := newPaymentRequest(query)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, failResponse(err.Error()), 400)
+		return
+	}
+
+	size := qrDefaultSize
+	if query.Get("size") != "" {
+		size, err = strconv.Atoi(query.Get("size"))
+		if err != nil || size < qrMinSize || size > qrMaxSize {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, failResponse(fmt.Sprintf("size must be between %d and %d", qrMinSize, qrMaxSize)), 400)
+			return
+		}
+	}
+
+	qr, err := qrcode.New(resp.Uri, qrcode.Medium)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	switch query.Get("format") {
+	case "", "png":
+		image, err := qr.PNG(size)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, standardFailResponse, 500)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(image)
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(qrSvg(qr.Bitmap()))
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, failResponse("format must be png or svg"), 400)
+	}
+
+}
+
+//newPaymentRequest validates the payment request parameters and builds its URI. Fiat amounts are
+//converted to SCP with the cached SCP price and exchange rates
+func newPaymentRequest(query url.Values) (PaymentRequestResp, error) {
+
+	resp := PaymentRequestResp{
+		Address: query.Get("address"),
+		Label:   query.Get("label"),
+		Message: query.Get("message"),
+	}
+	if spdbridge.ValidateAddress(resp.Address) != nil {
+		return resp, errors.New("invalid address")
+	}
+
+	var params []string
+	if query.Get("amount") != "" {
+		resp.Currency = strings.ToUpper(query.Get("currency"))
+		if resp.Currency == "" {
+			resp.Currency = "SCP"
+		}
+		hastings, price, err := scpAmount(query.Get("amount"), resp.Currency)
+		if err != nil {
+			return resp, err
+		}
+		resp.Amount = hastings.String()
+		resp.ScpAmount = formatScp(hastings, 27)
+		if price != nil {
+			resp.FiatAmount = query.Get("amount")
+			resp.ExchangeRate = price.FloatString(12)
+		}
+		params = append(params, "amount="+resp.ScpAmount)
+	}
+	if resp.Label != "" {
+		params = append(params, "label="+uriEscape(resp.Label))
+	}
+	if resp.Message != "" {
+		params = append(params, "message="+uriEscape(resp.Message))
+	}
+
+	resp.Uri = paymentUriScheme + ":" + resp.Address
+	if len(params) > 0 {
+		resp.Uri += "?" + strings.Join(params, "&")
+	}
+	return resp, nil
+
+}
+
+//uriEscape escapes the value for the URI query, with spaces as %20 like wallets expect
+func uriEscape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+//qrSvg renders the QR code modules as an SVG image, one unit per module
+func qrSvg(bitmap [][]bool) []byte {
+
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, len(bitmap), len(bitmap))
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, len(bitmap), len(bitmap))
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&svg, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	svg.WriteString(`"/></svg>`)
+	return svg.Bytes()
+
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestPaymentRequest(t *testing.T) {
+
+	price := 0.01
+	usdPrice = &price
+	exchangeRates = &map[string]float64{"EUR": 0.5}
+
+	tests := []struct {
+		query url.Values
+		uri   string
+	}{
+		{url.Values{"address": {testAddress}}, "scprime:" + testAddress},
+		{url.Values{"address": {testAddress}, "amount": {"1.5"}}, "scprime:" + testAddress + "?amount=1.5"},
+		{url.Values{"address": {testAddress}, "amount": {"1"}, "currency": {"eur"}, "label": {"Coffee shop"}, "message": {"order #1&2"}},
+			"scprime:" + testAddress + "?amount=200&label=Coffee%20shop&message=order%20%231%262"},
+	}
+	for _, test := range tests {
+		resp, err := newPaymentRequest(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Uri != test.uri {
+			t.Errorf("expected uri %v, got %v", test.uri, resp.Uri)
+		}
+	}
+
+	for _, query := range []url.Values{
+		{"address": {"a"}},
+		{"address": {testAddress}, "amount": {"-1"}},
+		{"address": {testAddress}, "amount": {"1"}, "currency": {"XYZ"}},
+	} {
+		if _, err := newPaymentRequest(query); err == nil {
+			t.Errorf("expected %v to be rejected", query)
+		}
+	}
+
+}
+
+func TestPaymentQr(t *testing.T) {
+
+	server := httptest.NewServer(buildRouter())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/v1/payment/qr?size=128&address=" + testAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("unexpected content type %v", resp.Header.Get("Content-Type"))
+	}
+	image, err := png.Decode(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.Bounds().Dx() != 128 {
+		t.Fatalf("unexpected image size %v", image.Bounds())
+	}
+
+	resp, err = http.Get(server.URL + "/v1/payment/qr?format=svg&address=" + testAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "image/svg+xml" || !bytes.HasPrefix(body, []byte("<svg")) {
+		t.Fatalf("unexpected svg response %v %s", resp.Header.Get("Content-Type"), body)
+	}
+
+	resp, err = http.Get(server.URL + "/v1/payment/uri?address=" + testAddress + "&amount=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request PaymentRequestResp
+	json.NewDecoder(resp.Body).Decode(&request)
+	resp.Body.Close()
+	if request.Amount != "2000000000000000000000000000" || request.ScpAmount != "2" {
+		t.Fatalf("unexpected payment request %+v", request)
+	}
+
+}
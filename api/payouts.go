@@ -0,0 +1,108 @@
+package main
+
+import (
+	"scp-app-api/spdbridge"
+)
+
+//maturityDelay is the number of blocks the miner payouts and the contract payouts wait before they can be spent
+const maturityDelay = 144
+
+//delayedOutputs finds the miner payouts and the contract payouts to the requested addresses in the blocks and the
+//contracts returned by the explorer. The payouts which have matured at height are returned as transactions too, of
+//the minerPayout, storageProofPayout or missedProofPayout type, so that they're part of the address history from
+//when they can be spent
+func delayedOutputs(addresses []string, explorerAddresses *spdbridge.AddressesBatchResp, height uint64) (outputs []DelayedOutput, matured []Transaction) {
+
+	requested := make(map[string]struct{})
+	for _, address := range addresses {
+		requested[address] = struct{}{}
+	}
+
+	seenBlocks := make(map[string]struct{})
+	for _, explorerAddress := range explorerAddresses.Addresses {
+		for _, block := range explorerAddress.Blocks {
+			if _, ok := seenBlocks[block.BlockId]; ok {
+				continue
+			}
+			seenBlocks[block.BlockId] = struct{}{}
+
+			maturityHeight := block.Height + maturityDelay
+			isMatured := height >= maturityHeight
+			for i, payout := range block.RawBlock.MinerPayouts {
+				if _, ok := requested[payout.UnlockHash]; !ok {
+					continue
+				}
+				output := DelayedOutput{
+					Address:        payout.UnlockHash,
+					Value:          payout.Value,
+					Source:         transactionMinerPayout,
+					Height:         block.Height,
+					MaturityHeight: maturityHeight,
+					Matured:        isMatured,
+				}
+				if i < len(block.MinerPayoutIds) {
+					output.Id = block.MinerPayoutIds[i]
+				}
+				outputs = append(outputs, output)
+			}
+			if isMatured {
+				matured = append(matured, Transaction{
+					ScpOutputs:     block.RawBlock.MinerPayouts,
+					Height:         block.Height,
+					BlockTimestamp: block.RawBlock.Timestamp,
+					Id:             block.BlockId,
+					Type:           transactionMinerPayout,
+					MaturityHeight: maturityHeight,
+				})
+			}
+		}
+	}
+
+	seenContracts := make(map[string]struct{})
+	for _, explorerAddress := range explorerAddresses.Addresses {
+		for _, payout := range explorerAddress.ContractPayouts {
+			if _, ok := seenContracts[payout.ContractId]; ok {
+				continue
+			}
+			seenContracts[payout.ContractId] = struct{}{}
+
+			source := transactionMissedProofPayout
+			if payout.ValidProof {
+				source = transactionStorageProofPayout
+			}
+			maturityHeight := payout.Height + maturityDelay
+			isMatured := height >= maturityHeight
+			paid := false
+			for i, output := range payout.Outputs {
+				if _, ok := requested[output.UnlockHash]; !ok {
+					continue
+				}
+				paid = true
+				delayed := DelayedOutput{
+					Address:        output.UnlockHash,
+					Value:          output.Value,
+					Source:         source,
+					Height:         payout.Height,
+					MaturityHeight: maturityHeight,
+					Matured:        isMatured,
+				}
+				if i < len(payout.OutputIds) {
+					delayed.Id = payout.OutputIds[i]
+				}
+				outputs = append(outputs, delayed)
+			}
+			if paid && isMatured {
+				matured = append(matured, Transaction{
+					ScpOutputs:     payout.Outputs,
+					Height:         payout.Height,
+					BlockTimestamp: payout.Timestamp,
+					Id:             payout.ContractId,
+					Type:           source,
+					MaturityHeight: maturityHeight,
+				})
+			}
+		}
+	}
+	return outputs, matured
+
+}
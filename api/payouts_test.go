@@ -0,0 +1,53 @@
+package main
+
+import (
+	"scp-app-api/spdbridge"
+	"testing"
+)
+
+func TestDelayedOutputs(t *testing.T) {
+
+	originalData := networkData
+	networkData = &NetworkData{ConsensusHeight: 200}
+	defer func() {
+		networkData = originalData
+	}()
+
+	block := func(id string, height uint64) spdbridge.ExplorerBlock {
+		return spdbridge.ExplorerBlock{
+			BlockId:        id,
+			Height:         height,
+			MinerPayoutIds: []string{id + "payout0", id + "payout1"},
+			RawBlock: spdbridge.ExplorerRawBlock{Timestamp: 1000 + height, MinerPayouts: []spdbridge.ScpOutput{
+				{Value: "10", UnlockHash: "miner"}, {Value: "5", UnlockHash: "fund"},
+			}},
+		}
+	}
+	explorerAddresses := &spdbridge.AddressesBatchResp{Addresses: []spdbridge.ExplorerAddress{
+		{Address: "miner", Blocks: []spdbridge.ExplorerBlock{block("matured", 56), block("immature", 57)}},
+		{Address: "fund", Blocks: []spdbridge.ExplorerBlock{block("matured", 56)}},
+	}}
+
+	result := filterTransactions(TransactionsBatchParams{Addresses: []string{"miner"}}, explorerAddresses, newTransactionPoolSnapshot(&spdbridge.TransactionPoolResp{}))
+	if len(result.DelayedOutputs) != 2 {
+		t.Fatalf("expected 2 delayed outputs, got %+v", result.DelayedOutputs)
+	}
+	matured, immature := result.DelayedOutputs[0], result.DelayedOutputs[1]
+	if matured.Id != "maturedpayout0" || matured.Value != "10" || matured.MaturityHeight != 200 || !matured.Matured || matured.Source != transactionMinerPayout {
+		t.Fatalf("unexpected matured payout %+v", matured)
+	}
+	if immature.Id != "immaturepayout0" || immature.MaturityHeight != 201 || immature.Matured {
+		t.Fatalf("unexpected immature payout %+v", immature)
+	}
+
+	//Only the matured payout is part of the history
+	if len(result.Transactions) != 1 {
+		t.Fatalf("expected the matured payout transaction, got %+v", result.Transactions)
+	}
+	transaction := result.Transactions[0].forVersion(1)
+	if transaction.Id != "matured" || transaction.Type != transactionMinerPayout || transaction.Height != 56 ||
+		transaction.BlockTimestamp != 1056 || transaction.MaturityHeight != 200 || len(transaction.ScpOutputs) != 2 {
+		t.Fatalf("unexpected payout transaction %+v", transaction)
+	}
+
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//saveJSON atomically writes v as JSON to the file name in dataDir
+func saveJSON(name string, v interface{}) error {
+
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dataDir, name)
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+
+}
+
+//loadJSON reads the JSON file name in dataDir into v, a missing file leaves v untouched
+func loadJSON(name string, v interface{}) error {
+
+	data, err := ioutil.ReadFile(filepath.Join(dataDir, name))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"scp-app-api/spdbridge"
+	"sync"
+	"time"
+)
+
+const devicesFile = "devices.json"
+
+const (
+	pushMaxAddresses   = 1000
+	pushRequestTimeout = 15 * time.Second
+
+	//devicesMax caps the devices registered, since every change rewrites devicesFile
+	devicesMax = 10000
+	//deviceRetention is how long a device is kept without registering again, the app registers at every start
+	deviceRetention     = 60 * 24 * time.Hour
+	devicePruneInterval = time.Hour
+)
+
+//fcmEndpoint is the FCM HTTP v1 send endpoint, %s is the Firebase project id
+const fcmEndpoint = "https://fcm.googleapis.com/v1/projects/%s/messages:send"
+
+//errPushTokenInvalid is returned by the notifiers when the push token is no longer valid, the device is then removed
+var errPushTokenInvalid = errors.New("push token not valid")
+
+type (
+	//pushNotifier sends a push notification to the device identified by token
+	pushNotifier interface {
+		Notify(ctx context.Context, token string, notification PushNotification) error
+	}
+
+	//fcmNotifier sends the notifications through the Firebase Cloud Messaging HTTP v1 API, authenticated with the
+	//OAuth2 tokens of a service account
+	fcmNotifier struct {
+		endpoint string
+		tokens   *serviceAccountTokens
+		client   *http.Client
+	}
+
+	fcmRequest struct {
+		Message fcmMessage `json:"message"`
+	}
+
+	fcmMessage struct {
+		Token        string            `json:"token"`
+		Notification fcmNotification   `json:"notification"`
+		Data         map[string]string `json:"data,omitempty"`
+		Android      fcmAndroidConfig  `json:"android"`
+	}
+
+	fcmNotification struct {
+		Title string `json:"title"`
+		Body  string `json:"body"`
+	}
+
+	fcmAndroidConfig struct {
+		Priority string `json:"priority"`
+	}
+
+	fcmErrorResponse struct {
+		Error struct {
+			Status  string `json:"status"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+
+	//device is a registered device, devices are persisted in devicesFile
+	device struct {
+		Token        string   `json:"token"`
+		Addresses    []string `json:"addresses"`
+		RegisteredAt int64    `json:"registeredAt"`
+
+		//SeenPool holds the keys of the pool transactions already notified, it's persisted so that they aren't
+		//notified again after a restart
+		SeenPool []string `json:"seenPool,omitempty"`
+	}
+)
+
+//notifier sends the push notifications, push is disabled when it's nil
+var notifier pushNotifier = nil
+
+var devices = struct {
+	sync.Mutex
+	devices map[string]*device
+}{devices: make(map[string]*device)}
+
+//newFcmNotifier builds the notifier from the service account key file, projectId defaults to the project of the
+//service account
+func newFcmNotifier(serviceAccountFile string, projectId string) (*fcmNotifier, error) {
+
+	account, err := loadServiceAccount(serviceAccountFile)
+	if err != nil {
+		return nil, err
+	}
+	if projectId == "" {
+		projectId = account.ProjectId
+	}
+	if projectId == "" {
+		return nil, errors.New("missing Firebase project id")
+	}
+	tokens, err := newServiceAccountTokens(account)
+	if err != nil {
+		return nil, err
+	}
+	return &fcmNotifier{
+		endpoint: fmt.Sprintf(fcmEndpoint, url.PathEscape(projectId)),
+		tokens:   tokens,
+		client:   &http.Client{Timeout: pushRequestTimeout},
+	}, nil
+
+}
+
+//Notify sends the notification to the FCM registration token
+func (n *fcmNotifier) Notify(ctx context.Context, token string, notification PushNotification) error {
+
+	body, err := json.Marshal(fcmRequest{Message: fcmMessage{
+		Token:        token,
+		Notification: fcmNotification{Title: notification.Title, Body: notification.Body},
+		Data:         notification.Data,
+		Android:      fcmAndroidConfig{Priority: "HIGH"},
+	}})
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := n.tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", n.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	response, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	respBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == 200 {
+		return nil
+	}
+	if response.StatusCode == 401 {
+		n.tokens.Invalidate()
+	}
+
+	var resp fcmErrorResponse
+	json.Unmarshal(respBody, &resp)
+	codes := []string{resp.Error.Status}
+	for _, detail := range resp.Error.Details {
+		codes = append(codes, detail.ErrorCode)
+	}
+	for _, code := range codes {
+		if code == "UNREGISTERED" || code == "INVALID_ARGUMENT" {
+			return errPushTokenInvalid
+		}
+	}
+	return fmt.Errorf("fcm error %d %v", response.StatusCode, resp.Error.Status)
+
+}
+
+//StartPushRelay loads the registered devices and registers them to the sync loops, it does nothing if push is disabled
+func StartPushRelay() {
+
+	if notifier == nil {
+		return
+	}
+
+	var registered map[string]*device
+	err := loadJSON(devicesFile, &registered)
+	if err != nil {
+		fmt.Printf("Error while loading push devices: %v\n", err)
+	}
+	devices.Lock()
+	for token, d := range registered {
+		//Devices registered before RegisteredAt was stored get a full retention
+		if d.RegisteredAt == 0 {
+			d.RegisteredAt = time.Now().Unix()
+		}
+		devices.devices[token] = d
+	}
+	devices.Unlock()
+
+	go syncDevices()
+	OnPoolChanged(pushPendingPayments)
+	OnHeightChanged(func(oldHeight uint64, newHeight uint64) {
+		if oldHeight > 0 {
+			go pushConfirmedPayments(oldHeight, newHeight)
+		}
+	})
+
+}
+
+func syncDevices() {
+
+	pruneDevices(time.Now())
+
+	time.Sleep(devicePruneInterval)
+	go syncDevices()
+
+}
+
+//pruneDevices removes the devices which haven't registered again for deviceRetention at now
+func pruneDevices(now time.Time) {
+
+	devices.Lock()
+	defer devices.Unlock()
+
+	pruned := false
+	for token, d := range devices.devices {
+		if now.After(time.Unix(d.RegisteredAt, 0).Add(deviceRetention)) {
+			delete(devices.devices, token)
+			pruned = true
+		}
+	}
+	if pruned {
+		err := saveDevices()
+		if err != nil {
+			fmt.Printf("Error while saving push devices: %v\n", err)
+		}
+	}
+
+}
+
+//newDeviceHandler handles requests to /devices
+//Registers the push token of a device along with the addresses it watches, registering
+//the same token again replaces its addresses
+func newDeviceHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if notifier == nil {
+		http.Error(w, failResponse("push notifications are not enabled"), 503)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+
+	var params DeviceParams
+	err = json.Unmarshal(body, &params)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+
+	if params.Token == "" {
+		http.Error(w, failResponse("token is required"), 400)
+		return
+	}
+	params.Addresses = uniqueStrings(params.Addresses)
+	if len(params.Addresses) == 0 || len(params.Addresses) > pushMaxAddresses {
+		http.Error(w, failResponse(fmt.Sprintf("between 1 and %d addresses are required", pushMaxAddresses)), 400)
+		return
+	}
+	for _, address := range params.Addresses {
+		if spdbridge.ValidateAddress(address) != nil {
+			http.Error(w, failResponse("invalid address "+address), 400)
+			return
+		}
+	}
+
+	devices.Lock()
+	previous, ok := devices.devices[params.Token]
+	if !ok && len(devices.devices) >= devicesMax {
+		devices.Unlock()
+		http.Error(w, failResponse("too many devices"), 503)
+		return
+	}
+	registered := &device{Token: params.Token, Addresses: params.Addresses, RegisteredAt: time.Now().Unix()}
+	if ok {
+		//Pool transactions already notified are not notified again
+		registered.SeenPool = previous.SeenPool
+	}
+	devices.devices[params.Token] = registered
+	err = saveDevices()
+	devices.Unlock()
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	fmt.Fprintf(w, standardSuccessResponse)
+}
+
+//deleteDeviceHandler handles DELETE requests to /devices/:token
+//Unregisters the device, it won't receive notifications anymore
+func deleteDeviceHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	devices.Lock()
+	_, ok := devices.devices[ps.ByName("token")]
+	delete(devices.devices, ps.ByName("token"))
+	err := saveDevices()
+	devices.Unlock()
+	if !ok {
+		http.Error(w, standardFailResponse, 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	fmt.Fprintf(w, standardSuccessResponse)
+}
+
+//pushPendingPayments notifies the devices of the payments entering the transaction pool
+func pushPendingPayments(snapshot *transactionPoolSnapshot) {
+
+	type push struct {
+		token        string
+		notification PushNotification
+	}
+	var pushes []push
+	changed := false
+	devices.Lock()
+	for _, d := range devices.devices {
+		fresh, related := newPoolTransactions(snapshot, d.Addresses, nil, stringSet(d.SeenPool))
+		//Without fresh transactions related is a subset of the seen ones, so it only changes if it shrinks
+		if len(fresh) > 0 || len(related) != len(d.SeenPool) {
+			changed = true
+			d.SeenPool = make([]string, 0, len(related))
+			for key := range related {
+				d.SeenPool = append(d.SeenPool, key)
+			}
+		}
+		for _, i := range fresh {
+			transaction := newTransactionFromUnconfirmed(snapshot.Transactions[i])
+			if notification, ok := paymentNotification(d.Addresses, transaction, false); ok {
+				pushes = append(pushes, push{token: d.Token, notification: notification})
+			}
+		}
+	}
+	if changed {
+		err := saveDevices()
+		if err != nil {
+			fmt.Printf("Error while saving push devices: %v\n", err)
+		}
+	}
+	devices.Unlock()
+
+	for _, p := range pushes {
+		go sendPush(p.token, p.notification)
+	}
+
+}
+
+//pushConfirmedPayments notifies the devices of the payments confirmed in the new blocks
+func pushConfirmedPayments(oldHeight uint64, newHeight uint64) {
+
+	devices.Lock()
+	var addresses []string
+	for _, d := range devices.devices {
+		addresses = append(addresses, d.Addresses...)
+	}
+	devices.Unlock()
+	if len(addresses) == 0 {
+		return
+	}
+
+	confirmed, err := confirmedTransactions(uniqueStrings(addresses), oldHeight, newHeight)
+	if err != nil {
+		fmt.Printf("Error while fetching confirmed payments: %v\n", err)
+		return
+	}
+
+	devices.Lock()
+	for _, d := range devices.devices {
+		for _, explorerTransaction := range confirmed {
+			notification, ok := paymentNotification(d.Addresses, newTransactionFromExplorer(explorerTransaction), true)
+			if ok {
+				go sendPush(d.Token, notification)
+			}
+		}
+	}
+	devices.Unlock()
+
+}
+
+//sendPush sends the notification, removing the device if its token is no longer valid
+func sendPush(token string, notification PushNotification) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), pushRequestTimeout)
+	defer cancel()
+
+	err := notifier.Notify(ctx, token, notification)
+	if err == errPushTokenInvalid {
+		devices.Lock()
+		delete(devices.devices, token)
+		err = saveDevices()
+		devices.Unlock()
+		if err != nil {
+			fmt.Printf("Error while saving push devices: %v\n", err)
+		}
+	} else if err != nil && verbose {
+		fmt.Printf("Push notification failed: %v\n", err)
+	}
+
+}
+
+//paymentNotification builds the notification of the transaction paying the addresses, ok is false if it doesn't pay
+//them or if it spends from them, since its outputs to the addresses are then the change of a payment sent
+func paymentNotification(addresses []string, transaction Transaction, confirmed bool) (notification PushNotification, ok bool) {
+
+	watched := stringSet(addresses)
+	if spendsFrom(transaction, watched) {
+		return notification, false
+	}
+	amount := new(big.Int)
+	var paid []string
+	for _, output := range transaction.ScpOutputs {
+		if _, ok := watched[output.UnlockHash]; !ok {
+			continue
+		}
+		value, ok := new(big.Int).SetString(output.Value, 10)
+		if !ok {
+			continue
+		}
+		amount.Add(amount, value)
+		paid = append(paid, output.UnlockHash)
+	}
+	if len(paid) == 0 {
+		return notification, false
+	}
+
+	eventType, title := webhookEventPending, "Incoming payment"
+	if confirmed {
+		eventType, title = webhookEventConfirmed, "Payment confirmed"
+	}
+	return PushNotification{
+		Title: title,
+		Body:  formatScp(amount, 4) + " SCP",
+		Data: map[string]string{
+			"type":          eventType,
+			"transactionId": transaction.Id,
+			"address":       paid[0],
+			"amount":        amount.String(),
+		},
+	}, true
+
+}
+
+//formatScp returns the hastings amount in SCP rounded to decimals, without trailing zeros
+func formatScp(hastings *big.Int, decimals int) string {
+	scp := new(big.Rat).SetFrac(hastings, hastingsPerScp)
+	formatted := scp.FloatString(decimals)
+	if decimals == 0 {
+		return formatted
+	}
+	for formatted[len(formatted)-1] == '0' {
+		formatted = formatted[:len(formatted)-1]
+	}
+	if formatted[len(formatted)-1] == '.' {
+		formatted = formatted[:len(formatted)-1]
+	}
+	return formatted
+}
+
+//saveDevices persists the devices, must be called holding the devices lock
+func saveDevices() error {
+	return saveJSON(devicesFile, devices.devices)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"scp-app-api/spdbridge"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeNotifier struct {
+	sent    chan PushNotification
+	invalid bool
+}
+
+func (n *fakeNotifier) Notify(_ context.Context, _ string, notification PushNotification) error {
+	invalid := n.invalid
+	n.sent <- notification
+	if invalid {
+		return errPushTokenInvalid
+	}
+	return nil
+}
+
+func TestPushPendingPayments(t *testing.T) {
+
+	dataDir = t.TempDir()
+	fake := &fakeNotifier{sent: make(chan PushNotification, 10)}
+	notifier = fake
+	defer func() { notifier = nil }()
+
+	server := httptest.NewServer(buildRouter())
+	defer server.Close()
+
+	params, _ := json.Marshal(DeviceParams{Token: "token", Addresses: []string{testAddress}})
+	resp, err := http.Post(server.URL+"/v1/devices", "application/json", bytes.NewReader(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("unexpected registration status %v", resp.StatusCode)
+	}
+
+	snapshot := newTransactionPoolSnapshot(&spdbridge.TransactionPoolResp{Transactions: []spdbridge.RawTransaction{
+		{ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: testAddress, Value: "1500000000000000000000000000"}}},
+	}})
+	pushPendingPayments(snapshot)
+	//The notified pool transactions are persisted, so they aren't notified again after a restart
+	var reloaded map[string]*device
+	if err := loadJSON(devicesFile, &reloaded); err != nil || len(reloaded["token"].SeenPool) != 1 {
+		t.Fatalf("expected the seen pool transaction to be persisted, got %v %+v", err, reloaded["token"])
+	}
+	devices.Lock()
+	devices.devices = reloaded
+	devices.Unlock()
+	pushPendingPayments(snapshot)
+
+	select {
+	case notification := <-fake.sent:
+		if notification.Body != "1.5 SCP" || notification.Data["type"] != webhookEventPending || notification.Data["address"] != testAddress {
+			t.Fatalf("unexpected notification %+v", notification)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("push not sent")
+	}
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-fake.sent:
+		t.Fatal("the same pool transaction was notified twice")
+	default:
+	}
+
+	//Devices whose token was revoked are removed
+	fake.invalid = true
+	pushPendingPayments(newTransactionPoolSnapshot(&spdbridge.TransactionPoolResp{Transactions: []spdbridge.RawTransaction{
+		{ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: testAddress, Value: "1"}}},
+	}}))
+	<-fake.sent
+	time.Sleep(50 * time.Millisecond)
+	devices.Lock()
+	_, ok := devices.devices["token"]
+	devices.Unlock()
+	if ok {
+		t.Fatal("device with an invalid token not removed")
+	}
+
+}
+
+func TestDevicesLimits(t *testing.T) {
+
+	dataDir = t.TempDir()
+	notifier = &fakeNotifier{sent: make(chan PushNotification, 10)}
+	now := time.Now()
+	defer func() {
+		notifier = nil
+		devices.Lock()
+		devices.devices = make(map[string]*device)
+		devices.Unlock()
+	}()
+
+	devices.Lock()
+	devices.devices = map[string]*device{
+		"stale":  {Token: "stale", RegisteredAt: now.Add(-deviceRetention - time.Hour).Unix()},
+		"recent": {Token: "recent", RegisteredAt: now.Add(-time.Hour).Unix()},
+	}
+	devices.Unlock()
+	pruneDevices(now)
+	devices.Lock()
+	_, stale := devices.devices["stale"]
+	_, recent := devices.devices["recent"]
+	devices.Unlock()
+	if stale || !recent {
+		t.Fatal("expected only the device not registered again within deviceRetention to be pruned")
+	}
+
+	devices.Lock()
+	for i := len(devices.devices); i < devicesMax; i++ {
+		token := fmt.Sprint(i)
+		devices.devices[token] = &device{Token: token, RegisteredAt: now.Unix()}
+	}
+	devices.Unlock()
+	register := func(token string) int {
+		params, _ := json.Marshal(DeviceParams{Token: token, Addresses: []string{testAddress}})
+		recorder := httptest.NewRecorder()
+		newDeviceHandler(recorder, httptest.NewRequest("POST", "/v1/devices", bytes.NewReader(params)), nil)
+		return recorder.Code
+	}
+	if statusCode := register("new"); statusCode != 503 {
+		t.Fatalf("expected new devices to be refused once devicesMax is reached, got %v", statusCode)
+	}
+	if statusCode := register("recent"); statusCode != 200 {
+		t.Fatalf("expected registered devices to be able to register again, got %v", statusCode)
+	}
+
+}
+
+//writeServiceAccount writes a service account key file with a new RSA key, using tokenUri as the token endpoint
+func writeServiceAccount(t *testing.T, tokenUri string) (string, *rsa.PublicKey) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, _ := json.Marshal(serviceAccount{
+		ProjectId:   "project",
+		ClientEmail: "push@project.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenUri:    tokenUri,
+	})
+	path := filepath.Join(t.TempDir(), "service-account.json")
+	if err := ioutil.WriteFile(path, account, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, &key.PublicKey
+
+}
+
+func TestFcmNotifier(t *testing.T) {
+
+	var tokenRequests int32
+	var publicKey *rsa.PublicKey
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokenRequests, 1)
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if r.FormValue("grant_type") != jwtBearerGrant || len(parts) != 3 {
+			w.WriteHeader(400)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature) != nil {
+			w.WriteHeader(400)
+			return
+		}
+		w.Write([]byte(`{"access_token":"accesstoken","expires_in":3600,"token_type":"Bearer"}`))
+	}))
+	defer tokens.Close()
+
+	var path string
+	var received fcmRequest
+	fcm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if r.Header.Get("Authorization") != "Bearer accesstoken" {
+			w.WriteHeader(401)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		switch received.Message.Token {
+		case "revoked":
+			w.WriteHeader(404)
+			w.Write([]byte(`{"error":{"code":404,"status":"NOT_FOUND","details":[{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"UNREGISTERED"}]}}`))
+		case "malformed":
+			w.WriteHeader(400)
+			w.Write([]byte(`{"error":{"code":400,"status":"INVALID_ARGUMENT"}}`))
+		case "unavailable":
+			w.WriteHeader(503)
+			w.Write([]byte(`{"error":{"code":503,"status":"UNAVAILABLE"}}`))
+		default:
+			w.Write([]byte(`{"name":"projects/project/messages/1"}`))
+		}
+	}))
+	defer fcm.Close()
+
+	credentials, key := writeServiceAccount(t, tokens.URL)
+	publicKey = key
+	n, err := newFcmNotifier(credentials, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.endpoint != "https://fcm.googleapis.com/v1/projects/project/messages:send" {
+		t.Fatalf("unexpected endpoint %v", n.endpoint)
+	}
+	n.endpoint = fcm.URL + "/v1/projects/project/messages:send"
+
+	notification := PushNotification{Title: "title", Body: "body", Data: map[string]string{"type": "pending"}}
+	if err := n.Notify(context.Background(), "token", notification); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/projects/project/messages:send" || received.Message.Token != "token" || received.Message.Notification.Title != "title" ||
+		received.Message.Data["type"] != "pending" {
+		t.Fatalf("unexpected request %v %+v", path, received)
+	}
+	for _, token := range []string{"revoked", "malformed"} {
+		if err := n.Notify(context.Background(), token, notification); err != errPushTokenInvalid {
+			t.Fatalf("expected errPushTokenInvalid for %v, got %v", token, err)
+		}
+	}
+	if err := n.Notify(context.Background(), "unavailable", notification); err == nil || err == errPushTokenInvalid {
+		t.Fatalf("expected a temporary error, got %v", err)
+	}
+	if atomic.LoadInt32(&tokenRequests) != 1 {
+		t.Fatalf("expected the access token to be reused, got %v token requests", tokenRequests)
+	}
+
+	//A rejected access token is dropped and requested again on the next notification
+	n.tokens.token = "expired"
+	if err := n.Notify(context.Background(), "token", notification); err == nil {
+		t.Fatal("expected an error with a rejected access token")
+	}
+	if err := n.Notify(context.Background(), "token", notification); err != nil || atomic.LoadInt32(&tokenRequests) != 2 {
+		t.Fatalf("expected a new access token, got %v after %v token requests", err, tokenRequests)
+	}
+
+	if _, err := newFcmNotifier(filepath.Join(t.TempDir(), "missing.json"), "project"); err == nil {
+		t.Fatal("expected an error for a missing service account file")
+	}
+
+}
+
+func TestPaymentNotificationChange(t *testing.T) {
+
+	unlockConditions := spdbridge.UnlockConditions{
+		SignaturesRequired: 1,
+		PublicKeys:         []spdbridge.ScpPublicKey{{Algorithm: ed25519Algorithm, Key: base64.StdEncoding.EncodeToString(make([]byte, ed25519PublicKeyLen))}},
+	}
+	address, err := unlockConditions.UnlockHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Sending coins from the address returns the change to it, which isn't an incoming payment
+	send := spdbridge.RawTransaction{
+		ScpInputs:  []spdbridge.ScpInput{{ParentId: "parent", UnlockConditions: unlockConditions}},
+		ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: testAddress, Value: "5"}, {UnlockHash: address, Value: "3"}},
+	}
+	if notification, ok := paymentNotification([]string{address}, newTransactionFromUnconfirmed(send), false); ok {
+		t.Fatalf("expected no notification for the change, got %+v", notification)
+	}
+	if notification, ok := paymentNotification([]string{testAddress}, newTransactionFromUnconfirmed(send), false); !ok || notification.Data["amount"] != "5" {
+		t.Fatalf("expected the recipient to be notified of the payment, got %v %+v", ok, notification)
+	}
+
+}
+
+func TestFormatScp(t *testing.T) {
+
+	tests := map[string]string{
+		"0":                             "0",
+		"1000000000000000000000000000":  "1",
+		"1234500000000000000000000000":  "1.2345",
+		"25000000000000000000000000000": "25",
+		"100000000000000000000000000":   "0.1",
+	}
+	for hastings, expected := range tests {
+		value, _ := new(big.Int).SetString(hastings, 10)
+		if formatted := formatScp(value, 4); formatted != expected {
+			t.Errorf("formatScp(%v) = %v, expected %v", hastings, formatted, expected)
+		}
+	}
+
+}
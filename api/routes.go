@@ -10,8 +10,30 @@ func buildRouter() *httprouter.Router {
 
 	router := httprouter.New()
 	router.GET(version+"/scprime/data", getScPrimeDataHandler)
+	router.GET(version+"/scprime/data/stream", networkDataStreamHandler)
+	router.GET(version+"/fees", getFeesHandler)
+	router.GET(version+"/blocks", getBlocksHandler)
+	router.GET(version+"/blocks/:id", getBlockHandler)
 	router.POST(version+"/addresses/transactions/batch", getAddressesTransactionsBatchHandler)
+	router.POST(version+"/addresses/spf/batch", getSpfBalancesHandler)
+	router.POST(version+"/addresses/outputs/batch", getOutputsBatchHandler)
+	router.POST(version+"/unlockconditions", newUnlockConditionsHandler)
 	router.POST(version+"/transactions", newTransactionHandler)
+	router.POST(version+"/transactions/validate", validateTransactionHandler)
+	router.POST(version+"/transactions/decode", decodeTransactionHandler)
+	router.GET(version+"/transactions/:id", getTransactionHandler)
+	router.GET(version+"/broadcasts/:id", getBroadcastHandler)
+	router.GET(version+"/cache/stats", getCacheStatsHandler)
+	router.GET(version+"/ws", wsHandler)
+	router.POST(version+"/webhooks", newWebhookHandler)
+	router.GET(version+"/webhooks/:id", getWebhookHandler)
+	router.DELETE(version+"/webhooks/:id", deleteWebhookHandler)
+	router.POST(version+"/devices", newDeviceHandler)
+	router.DELETE(version+"/devices/:token", deleteDeviceHandler)
+	router.POST(version+"/invoices", newInvoiceHandler)
+	router.GET(version+"/invoices/:id", getInvoiceHandler)
+	router.GET(version+"/payment/uri", paymentUriHandler)
+	router.GET(version+"/payment/qr", paymentQrHandler)
 
 	return router
 
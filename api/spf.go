@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"scp-app-api/spdbridge"
+	"sort"
+)
+
+//getSpfBalancesHandler handles requests to /addresses/spf/batch
+//Returns the SPF balance of each address requested along with its unspent SPF outputs, and the balance once the
+//transactions waiting in the pool are confirmed
+func getSpfBalancesHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+
+	var params SpfBalancesParams
+	err = json.Unmarshal(body, &params)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+	params.Addresses = uniqueStrings(params.Addresses)
+
+	ctx, cancel := context.WithTimeout(r.Context(), batchRequestTimeout)
+	defer cancel()
+
+	explorerAddresses, pool, err := GetAddressesAndPool(ctx, params.Addresses)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	jsonResp, err := json.Marshal(spfBalances(params.Addresses, explorerAddresses, pool))
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//spfBalances finds the unspent SPF outputs of each address in its confirmed transactions, then applies the pool
+//transactions spending them or paying SPF to the address to get the unconfirmed balance
+func spfBalances(addresses []string, explorerAddresses *spdbridge.AddressesBatchResp, pool *transactionPoolSnapshot) SpfBalancesResp {
+
+	history := make(map[string][]spdbridge.ExplorerTransaction)
+	for _, explorerAddress := range explorerAddresses.Addresses {
+		history[explorerAddress.Address] = explorerAddress.Transactions
+	}
+
+	resp := SpfBalancesResp{Addresses: []SpfBalance{}}
+	for _, address := range addresses {
+		created := make(map[string]SpfBalanceOutput)
+		spent := make(map[string]struct{})
+		for _, explorerTransaction := range history[address] {
+			transaction := spdbridge.Transaction(explorerTransaction.RawTransaction)
+			for i, output := range transaction.SpfOutputs {
+				if output.UnlockHash != address {
+					continue
+				}
+				id, err := transaction.SpfOutputId(uint64(i))
+				if err != nil {
+					continue
+				}
+				created[id] = SpfBalanceOutput{Id: id, Value: output.Value, Height: explorerTransaction.Height}
+			}
+			for _, input := range transaction.SpfInputs {
+				spent[input.ParentId] = struct{}{}
+			}
+		}
+
+		balance := SpfBalance{Address: address, Outputs: []SpfBalanceOutput{}}
+		confirmed := new(big.Int)
+		for id, output := range created {
+			if _, ok := spent[id]; ok {
+				continue
+			}
+			balance.Outputs = append(balance.Outputs, output)
+			if value, ok := new(big.Int).SetString(output.Value, 10); ok {
+				confirmed.Add(confirmed, value)
+			}
+		}
+		sort.Slice(balance.Outputs, func(i, j int) bool {
+			if balance.Outputs[i].Height != balance.Outputs[j].Height {
+				return balance.Outputs[i].Height < balance.Outputs[j].Height
+			}
+			return balance.Outputs[i].Id < balance.Outputs[j].Id
+		})
+
+		unconfirmed := new(big.Int).Set(confirmed)
+		//The pool is indexed by public key for the inputs, so the spent outputs are looked up in all its transactions
+		for _, transaction := range pool.Transactions {
+			for _, input := range transaction.SpfInputs {
+				if output, ok := created[input.ParentId]; ok {
+					if _, ok := spent[input.ParentId]; ok {
+						continue
+					}
+					if value, ok := new(big.Int).SetString(output.Value, 10); ok {
+						unconfirmed.Sub(unconfirmed, value)
+					}
+				}
+			}
+			for _, output := range transaction.SpfOutputs {
+				if output.UnlockHash != address {
+					continue
+				}
+				if value, ok := new(big.Int).SetString(output.Value, 10); ok {
+					unconfirmed.Add(unconfirmed, value)
+				}
+			}
+		}
+
+		balance.Balance = confirmed.String()
+		balance.UnconfirmedBalance = unconfirmed.String()
+		resp.Addresses = append(resp.Addresses, balance)
+	}
+	return resp
+
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"scp-app-api/spdbridge"
+	"strings"
+	"testing"
+)
+
+func TestSpfBalances(t *testing.T) {
+
+	//The output ids are computed from the binary encoding, which needs hex addresses
+	spfAddress := strings.Repeat("a", 76)
+	otherAddress := strings.Repeat("b", 76)
+
+	funding := spdbridge.RawTransaction{SpfOutputs: []spdbridge.SpfOutput{
+		{Value: "100", UnlockHash: spfAddress, ClaimStart: "0"},
+		{Value: "50", UnlockHash: spfAddress, ClaimStart: "0"},
+		{Value: "25", UnlockHash: otherAddress, ClaimStart: "0"},
+	}}
+	fundingTransaction := spdbridge.Transaction(funding)
+	spentId, _ := fundingTransaction.SpfOutputId(0)
+	pendingId, _ := fundingTransaction.SpfOutputId(1)
+	spending := spdbridge.RawTransaction{
+		SpfInputs:  []spdbridge.SpfInput{{ParentId: spentId, ClaimUnlockHash: spfAddress}},
+		SpfOutputs: []spdbridge.SpfOutput{{Value: "10", UnlockHash: spfAddress, ClaimStart: "0"}},
+	}
+	explorerAddresses := &spdbridge.AddressesBatchResp{Addresses: []spdbridge.ExplorerAddress{{
+		Address: spfAddress,
+		Transactions: []spdbridge.ExplorerTransaction{
+			{RawTransaction: funding, Id: "funding", Height: 10},
+			{RawTransaction: spending, Id: "spending", Height: 12},
+		},
+	}}}
+	pool := newTransactionPoolSnapshot(&spdbridge.TransactionPoolResp{Transactions: []spdbridge.RawTransaction{{
+		SpfInputs:  []spdbridge.SpfInput{{ParentId: pendingId, ClaimUnlockHash: spfAddress}},
+		SpfOutputs: []spdbridge.SpfOutput{{Value: "5", UnlockHash: spfAddress, ClaimStart: "0"}, {Value: "45", UnlockHash: otherAddress, ClaimStart: "0"}},
+	}}})
+
+	resp := spfBalances([]string{spfAddress, "empty"}, explorerAddresses, pool)
+	if len(resp.Addresses) != 2 {
+		t.Fatalf("expected 2 addresses, got %+v", resp)
+	}
+	balance := resp.Addresses[0]
+	if balance.Balance != "60" || balance.UnconfirmedBalance != "15" {
+		t.Fatalf("unexpected balance %+v", balance)
+	}
+	if len(balance.Outputs) != 2 || balance.Outputs[0].Id != pendingId || balance.Outputs[0].Height != 10 || balance.Outputs[1].Value != "10" {
+		t.Fatalf("unexpected outputs %+v", balance.Outputs)
+	}
+	if empty := resp.Addresses[1]; empty.Balance != "0" || empty.UnconfirmedBalance != "0" || len(empty.Outputs) != 0 {
+		t.Fatalf("unexpected empty balance %+v", empty)
+	}
+
+	//Pool transactions paying SPF match the requested addresses like SCP outputs
+	result := filterTransactions(TransactionsBatchParams{Addresses: []string{otherAddress}}, &spdbridge.AddressesBatchResp{}, pool)
+	if len(result.Transactions) != 1 || len(result.Transactions[0].SpfOutputs) != 2 {
+		t.Fatalf("expected the pool transaction paying SPF, got %+v", result)
+	}
+
+}
+
+func TestWithoutSpfOnly(t *testing.T) {
+
+	address := strings.Repeat("a", 76)
+	transactions := []Transaction{
+		newTransactionFromUnconfirmed(spdbridge.RawTransaction{SpfOutputs: []spdbridge.SpfOutput{{UnlockHash: address, Value: "1"}}}),
+		newTransactionFromUnconfirmed(spdbridge.RawTransaction{
+			SpfOutputs: []spdbridge.SpfOutput{{UnlockHash: address, Value: "1"}},
+			ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: address, Value: "2"}},
+		}),
+		newTransactionFromUnconfirmed(spdbridge.RawTransaction{SpfInputs: []spdbridge.SpfInput{{ParentId: "spf", ClaimUnlockHash: address}}}),
+		newTransactionFromUnconfirmed(spdbridge.RawTransaction{ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: address, Value: "3"}}}),
+	}
+
+	filtered := withoutSpfOnly(transactions, []string{address}, nil)
+	if len(filtered) != 2 || filtered[0].ScpOutputs[0].Value != "2" || filtered[1].ScpOutputs[0].Value != "3" {
+		t.Fatalf("expected only the transactions paying SCP to the address, got %+v", filtered)
+	}
+
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	//sseHistorySize is the number of past events kept to resume the streams of reconnecting clients
+	sseHistorySize       = 32
+	sseSendBuffer        = 16
+	sseKeepAliveInterval = 30 * time.Second
+	sseRetryMilliseconds = 10000
+)
+
+type sseEvent struct {
+	id   uint64
+	data []byte
+}
+
+var sseStream = struct {
+	sync.Mutex
+	history     []sseEvent
+	nextId      uint64
+	subscribers map[chan sseEvent]struct{}
+}{nextId: 1, subscribers: make(map[chan sseEvent]struct{})}
+
+//StartNetworkDataStream registers the Server-Sent Events stream to the sync loops
+func StartNetworkDataStream() {
+	OnNetworkDataChanged(publishNetworkData)
+}
+
+//publishNetworkData sends the current network data to the stream subscribers and stores it in the history
+func publishNetworkData() {
+
+	data, err := json.Marshal(buildNetworkDataResponse())
+	if err != nil {
+		return
+	}
+
+	sseStream.Lock()
+	defer sseStream.Unlock()
+
+	event := sseEvent{id: sseStream.nextId, data: data}
+	sseStream.nextId++
+	sseStream.history = append(sseStream.history, event)
+	if len(sseStream.history) > sseHistorySize {
+		sseStream.history = sseStream.history[len(sseStream.history)-sseHistorySize:]
+	}
+
+	for subscriber := range sseStream.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			//Slow clients are dropped, they will resume from their last event id
+			delete(sseStream.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+
+}
+
+//networkDataStreamHandler handles requests to /scprime/data/stream
+//Streams the network data response every time the consensus height, fees, SCP price or fiat rates change.
+//Clients reconnecting with Last-Event-ID receive the events they missed, or the latest one if they are too old
+func networkDataStreamHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	subscriber := make(chan sseEvent, sseSendBuffer)
+	sseStream.Lock()
+	backlog := sseBacklog(r.Header.Get("Last-Event-ID"))
+	sseStream.subscribers[subscriber] = struct{}{}
+	sseStream.Unlock()
+
+	defer func() {
+		sseStream.Lock()
+		if _, ok := sseStream.subscribers[subscriber]; ok {
+			delete(sseStream.subscribers, subscriber)
+			close(subscriber)
+		}
+		sseStream.Unlock()
+	}()
+
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetryMilliseconds)
+	for _, event := range backlog {
+		writeSseEvent(w, event)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-subscriber:
+			if !ok {
+				return
+			}
+			writeSseEvent(w, event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+
+}
+
+//sseBacklog returns the events following lastEventId, or the latest event when lastEventId is missing,
+//invalid or no longer in the history. Must be called holding the sseStream lock
+func sseBacklog(lastEventId string) []sseEvent {
+
+	if len(sseStream.history) == 0 {
+		return nil
+	}
+
+	id, err := strconv.ParseUint(lastEventId, 10, 64)
+	oldest := sseStream.history[0].id
+	if err != nil || id+1 < oldest || id >= sseStream.nextId {
+		return sseStream.history[len(sseStream.history)-1:]
+	}
+
+	return append([]sseEvent(nil), sseStream.history[id+1-oldest:]...)
+
+}
+
+func writeSseEvent(w http.ResponseWriter, event sseEvent) {
+	fmt.Fprintf(w, "id: %d\nevent: networkdata\ndata: %s\n\n", event.id, event.data)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//readSseIds reads the stream until count events are received and returns their ids
+func readSseIds(t *testing.T, reader *bufio.Reader, count int) []string {
+
+	var ids []string
+	for len(ids) < count {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(line, "id: ") {
+			ids = append(ids, strings.TrimSpace(strings.TrimPrefix(line, "id: ")))
+		}
+	}
+	return ids
+
+}
+
+func TestNetworkDataStream(t *testing.T) {
+
+	originalData, originalPrice, originalRates := networkData, usdPrice, exchangeRates
+	defer func() { networkData, usdPrice, exchangeRates = originalData, originalPrice, originalRates }()
+	price := 0.01
+	networkData = &NetworkData{ConsensusHeight: 1}
+	usdPrice = &price
+	exchangeRates = &map[string]float64{"EUR": 0.9}
+	for i := 0; i < 3; i++ {
+		publishNetworkData()
+	}
+
+	server := httptest.NewServer(buildRouter())
+	defer server.Close()
+
+	//A new client receives the latest event, then the following ones
+	resp, err := http.Get(server.URL + "/v1/scprime/data/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %v", resp.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(resp.Body)
+	ids := readSseIds(t, reader, 1)
+	if ids[0] != "3" {
+		t.Fatalf("expected latest event 3, got %v", ids)
+	}
+	publishNetworkData()
+	ids = readSseIds(t, reader, 1)
+	if ids[0] != "4" {
+		t.Fatalf("expected event 4, got %v", ids)
+	}
+
+	//A reconnecting client receives the events it missed
+	request, _ := http.NewRequest("GET", server.URL+"/v1/scprime/data/stream", nil)
+	request.Header.Set("Last-Event-ID", "1")
+	resumed, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Body.Close()
+	ids = readSseIds(t, bufio.NewReader(resumed.Body), 3)
+	if strings.Join(ids, ",") != "2,3,4" {
+		t.Fatalf("expected events 2,3,4, got %v", ids)
+	}
+
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"scp-app-api/spdbridge"
+	"sort"
+)
+
+//transactionPoolSnapshot is a copy of the spd transaction pool indexed by the addresses receiving the SCP and SPF
+//outputs and by the public keys unlocking the inputs and the contract revisions of each transaction
+type transactionPoolSnapshot struct {
+	Transactions []spdbridge.RawTransaction
+	//Keys identify the transactions across snapshots: their ids, or a hash of their content when the ids couldn't
+	//be computed
+	Keys []string
+	//Ids and Sizes are empty when spd's transactions couldn't be encoded
+	Ids   []string
+	Sizes []uint64
+
+	byAddress   map[string][]int
+	byPublicKey map[string][]int
+}
+
+//newTransactionPoolSnapshot indexes the transactions of the pool provided
+func newTransactionPoolSnapshot(pool *spdbridge.TransactionPoolResp) *transactionPoolSnapshot {
+
+	snapshot := transactionPoolSnapshot{
+		Transactions: pool.Transactions,
+		Ids:          pool.Ids,
+		Sizes:        pool.Sizes,
+		byAddress:    make(map[string][]int),
+		byPublicKey:  make(map[string][]int),
+	}
+	for i, transaction := range pool.Transactions {
+		if len(pool.Ids) == len(pool.Transactions) {
+			snapshot.Keys = append(snapshot.Keys, pool.Ids[i])
+		} else {
+			snapshot.Keys = append(snapshot.Keys, poolTransactionKey(transaction))
+		}
+		for _, output := range transaction.ScpOutputs {
+			snapshot.byAddress[output.UnlockHash] = appendIndex(snapshot.byAddress[output.UnlockHash], i)
+		}
+		for _, output := range transaction.SpfOutputs {
+			snapshot.byAddress[output.UnlockHash] = appendIndex(snapshot.byAddress[output.UnlockHash], i)
+		}
+		for _, input := range transaction.ScpInputs {
+			for _, publicKey := range input.UnlockConditions.PublicKeys {
+				snapshot.byPublicKey[publicKey.Key] = appendIndex(snapshot.byPublicKey[publicKey.Key], i)
+			}
+		}
+		//Contract revisions are signed by both the renter and the host
+		for _, revision := range transaction.FileContractRevisions {
+			for _, publicKey := range revision.UnlockConditions.PublicKeys {
+				snapshot.byPublicKey[publicKey.Key] = appendIndex(snapshot.byPublicKey[publicKey.Key], i)
+			}
+		}
+		for _, input := range transaction.SpfInputs {
+			//The SCP dividends claimed spending SPF are paid to the claim address
+			snapshot.byAddress[input.ClaimUnlockHash] = appendIndex(snapshot.byAddress[input.ClaimUnlockHash], i)
+			for _, publicKey := range input.UnlockConditions.PublicKeys {
+				snapshot.byPublicKey[publicKey.Key] = appendIndex(snapshot.byPublicKey[publicKey.Key], i)
+			}
+		}
+	}
+	return &snapshot
+
+}
+
+//relatedTransactions returns, in pool order, the transactions paying to one of the addresses
+//or spending from one of the public keys provided
+func (s *transactionPoolSnapshot) relatedTransactions(addresses []string, publicKeys []string) []spdbridge.RawTransaction {
+
+	indexes := s.relatedIndexes(addresses, publicKeys)
+	related := make([]spdbridge.RawTransaction, 0, len(indexes))
+	for _, i := range indexes {
+		related = append(related, s.Transactions[i])
+	}
+	return related
+
+}
+
+//relatedIndexes is like relatedTransactions but returns the positions of the transactions in the snapshot
+func (s *transactionPoolSnapshot) relatedIndexes(addresses []string, publicKeys []string) []int {
+
+	indexes := make(map[int]struct{})
+	for _, address := range addresses {
+		for _, i := range s.byAddress[address] {
+			indexes[i] = struct{}{}
+		}
+	}
+	for _, publicKey := range publicKeys {
+		for _, i := range s.byPublicKey[publicKey] {
+			indexes[i] = struct{}{}
+		}
+	}
+
+	sorted := make([]int, 0, len(indexes))
+	for i := range indexes {
+		sorted = append(sorted, i)
+	}
+	sort.Ints(sorted)
+	return sorted
+
+}
+
+//poolTransactionKey hashes the content of a pool transaction. Transactions in the pool can't spend the same
+//outputs, so the key is unique within the pool and stable across snapshots
+func poolTransactionKey(transaction spdbridge.RawTransaction) string {
+
+	data, _ := json.Marshal(transaction)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+
+}
+
+//appendIndex appends i to indexes unless it's already the last element,
+//which happens when a transaction has several outputs to the same address
+func appendIndex(indexes []int, i int) []int {
+
+	if len(indexes) > 0 && indexes[len(indexes)-1] == i {
+		return indexes
+	}
+	return append(indexes, i)
+
+}
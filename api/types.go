@@ -12,27 +12,371 @@ type (
 	}
 
 	NewTransactionParams struct {
-		BroadcastData BroadcastData `json:"broadcastData"`
-		ValidateData  string        `json:"validateData"`
+		//TransactionSet is the transaction set in spd's JSON format, encoded server side. When it's missing
+		//the set is taken from BroadcastData and ValidateData
+		TransactionSet []spdbridge.Transaction `json:"transactionSet,omitempty"`
+		BroadcastData  BroadcastData           `json:"broadcastData"`
+		ValidateData   string                  `json:"validateData"`
 	}
 
 	TransactionsBatchParams struct {
 		Addresses  []string `json:"addresses"`
 		PublicKeys []string `json:"publickeys"`
+		//UnlockConditions add their address and all their public keys, such as the ones of multisig participants
+		UnlockConditions []spdbridge.UnlockConditions `json:"unlockconditions,omitempty"`
+	}
+
+	UnlockConditionsParams struct {
+		PublicKeys         []string `json:"publicKeys"`
+		SignaturesRequired uint64   `json:"signaturesRequired"`
+		Timelock           uint64   `json:"timelock"`
+	}
+
+	UnlockConditionsResp struct {
+		UnlockConditions spdbridge.UnlockConditions `json:"unlockConditions"`
+		Address          string                     `json:"address"`
+		//Spendable tells whether the timelock has been reached at the current consensus height
+		Spendable bool `json:"spendable"`
+	}
+
+	OutputsBatchParams struct {
+		Addresses        []string                     `json:"addresses"`
+		UnlockConditions []spdbridge.UnlockConditions `json:"unlockconditions"`
+	}
+
+	OutputsBatchResp struct {
+		Height  uint64          `json:"height"`
+		Outputs []UnspentOutput `json:"outputs"`
+	}
+
+	UnspentOutput struct {
+		Id             string `json:"id"`
+		Address        string `json:"address"`
+		Value          string `json:"value"`
+		Height         uint64 `json:"height"`
+		Source         string `json:"source"`
+		MaturityHeight uint64 `json:"maturityHeight,omitempty"`
+		Timelock       uint64 `json:"timelock"`
+		//UnlockConditions are nil when they haven't been provided and no input has spent from the address yet, then
+		//Timelock is unknown and the output isn't reported as spendable
+		UnlockConditions *spdbridge.UnlockConditions `json:"unlockConditions"`
+		PendingSpent     bool                        `json:"pendingSpent"`
+		Spendable        bool                        `json:"spendable"`
+	}
+
+	SpfBalancesParams struct {
+		Addresses []string `json:"addresses"`
 	}
 
 	TransactionsBatchResp struct {
 		Transactions []Transaction `json:"transactions"`
+		//DelayedOutputs are the miner payouts to the requested addresses, matured or not
+		DelayedOutputs []DelayedOutput `json:"delayedoutputs,omitempty"`
+	}
+
+	DelayedOutput struct {
+		Id             string `json:"id"`
+		Address        string `json:"address"`
+		Value          string `json:"value"`
+		Source         string `json:"source"`
+		Height         uint64 `json:"height"`
+		MaturityHeight uint64 `json:"maturityheight"`
+		Matured        bool   `json:"matured"`
+	}
+
+	TransactionStatusResp struct {
+		Id             string       `json:"id"`
+		Status         string       `json:"status"`
+		Height         uint64       `json:"height,omitempty"`
+		Confirmations  uint64       `json:"confirmations"`
+		BlockTimestamp uint64       `json:"blocktimestamp,omitempty"`
+		Transaction    *Transaction `json:"transaction,omitempty"`
+	}
+
+	TransactionValidationResp struct {
+		Valid          bool                   `json:"valid"`
+		ConsensusValid bool                   `json:"consensusValid"`
+		ConsensusError string                 `json:"consensusError,omitempty"`
+		Transactions   []ValidatedTransaction `json:"transactions"`
+		Size           uint64                 `json:"size"`
+		TotalFee       string                 `json:"totalFee"`
+		FeePerByte     string                 `json:"feePerByte"`
+		MinimumFee     string                 `json:"minimumFee"`
+		FeeSufficient  bool                   `json:"feeSufficient"`
+		Errors         []string               `json:"errors"`
+	}
+
+	ValidatedTransaction struct {
+		Id     string           `json:"id"`
+		Size   uint64           `json:"size"`
+		Fee    string           `json:"fee"`
+		Inputs []ValidatedInput `json:"inputs"`
+	}
+
+	ValidatedInput struct {
+		ParentId string `json:"parentId"`
+		Status   string `json:"status"`
+		Timelock uint64 `json:"timelock"`
+		Unlocked bool   `json:"unlocked"`
+	}
+
+	DecodedTransactionsResp struct {
+		Transactions []DecodedTransaction `json:"transactions"`
+	}
+
+	FeeEstimateResp struct {
+		Low              FeeRecommendation `json:"low"`
+		Normal           FeeRecommendation `json:"normal"`
+		Priority         FeeRecommendation `json:"priority"`
+		MinFee           string            `json:"minFee"`
+		MaxFee           string            `json:"maxFee"`
+		PoolTransactions int               `json:"poolTransactions"`
+		PoolSize         uint64            `json:"poolSize"`
+		Congested        bool              `json:"congested"`
+		Observations     int               `json:"observations"`
+		PoolHistory      []FeePoolSample   `json:"poolHistory"`
+	}
+
+	FeeRecommendation struct {
+		FeePerByte       string `json:"feePerByte"`
+		TargetBlocks     uint64 `json:"targetBlocks"`
+		EstimatedMinutes uint64 `json:"estimatedMinutes"`
+		Fee              string `json:"fee,omitempty"`
+	}
+
+	BroadcastResp struct {
+		Id            string   `json:"id"`
+		ParentIds     []string `json:"parentIds"`
+		Status        string   `json:"status"`
+		BroadcastAt   int64    `json:"broadcastAt"`
+		LastCheckedAt int64    `json:"lastCheckedAt"`
+		Rebroadcasts  int      `json:"rebroadcasts"`
+		LastError     string   `json:"lastError,omitempty"`
+	}
+
+	WebhookParams struct {
+		Url       string   `json:"url"`
+		Addresses []string `json:"addresses"`
+		Secret    string   `json:"secret"`
+	}
+
+	WebhookResp struct {
+		Id         string            `json:"id"`
+		Url        string            `json:"url"`
+		Addresses  []string          `json:"addresses"`
+		Secret     string            `json:"secret,omitempty"`
+		Deliveries []WebhookDelivery `json:"deliveries"`
+		//ActiveAt is the last activity of the webhook, it's removed after 30 days without any
+		ActiveAt int64 `json:"activeAt"`
+	}
+
+	WebhookPayload struct {
+		EventId     string      `json:"eventId"`
+		WebhookId   string      `json:"webhookId"`
+		Type        string      `json:"type"`
+		Timestamp   int64       `json:"timestamp"`
+		Addresses   []string    `json:"addresses"`
+		Transaction Transaction `json:"transaction"`
+	}
+
+	DeviceParams struct {
+		Token     string   `json:"token"`
+		Addresses []string `json:"addresses"`
+	}
+
+	InvoiceParams struct {
+		Address       string  `json:"address"`
+		Amount        string  `json:"amount"`
+		Currency      string  `json:"currency"`
+		ExpiresIn     int64   `json:"expiresIn"`
+		Confirmations *uint64 `json:"confirmations"`
+	}
+
+	InvoiceResp struct {
+		Id                    string               `json:"id"`
+		Address               string               `json:"address"`
+		Status                string               `json:"status"`
+		Amount                string               `json:"amount"`
+		Received              string               `json:"received"`
+		Pending               string               `json:"pending"`
+		FiatAmount            string               `json:"fiatAmount,omitempty"`
+		Currency              string               `json:"currency"`
+		ExchangeRate          string               `json:"exchangeRate,omitempty"`
+		CreatedAt             int64                `json:"createdAt"`
+		ExpiresAt             int64                `json:"expiresAt"`
+		RequiredConfirmations uint64               `json:"requiredConfirmations"`
+		Transactions          []InvoiceTransaction `json:"transactions"`
+	}
+
+	PaymentRequestResp struct {
+		Uri          string `json:"uri"`
+		Address      string `json:"address"`
+		Amount       string `json:"amount,omitempty"`
+		ScpAmount    string `json:"scpAmount,omitempty"`
+		FiatAmount   string `json:"fiatAmount,omitempty"`
+		Currency     string `json:"currency,omitempty"`
+		ExchangeRate string `json:"exchangeRate,omitempty"`
+		Label        string `json:"label,omitempty"`
+		Message      string `json:"message,omitempty"`
+	}
+
+	WsSubscribeParams struct {
+		Type       string   `json:"type"`
+		Addresses  []string `json:"addresses"`
+		PublicKeys []string `json:"publickeys"`
+	}
+
+	WsEvent struct {
+		Type        string               `json:"type"`
+		Height      uint64               `json:"height,omitempty"`
+		Transaction *Transaction         `json:"transaction,omitempty"`
+		NetworkData *NetworkDataResponse `json:"networkData,omitempty"`
 	}
 )
 
 type (
 	NetworkData struct {
 		ConsensusHeight uint64 `json:"consensusHeight"`
+		CurrentBlock    string `json:"currentBlock"`
 		MinFee          string `json:"minFee"`
 		MaxFee          string `json:"maxFee"`
 	}
 
+	WebhookDelivery struct {
+		EventId       string           `json:"eventId"`
+		Type          string           `json:"type"`
+		TransactionId string           `json:"transactionId"`
+		Delivered     bool             `json:"delivered"`
+		Attempts      []WebhookAttempt `json:"attempts"`
+	}
+
+	PushNotification struct {
+		Title string            `json:"title"`
+		Body  string            `json:"body"`
+		Data  map[string]string `json:"data"`
+	}
+
+	InvoiceTransaction struct {
+		Id            string `json:"id,omitempty"`
+		Amount        string `json:"amount"`
+		Height        uint64 `json:"height,omitempty"`
+		Confirmations uint64 `json:"confirmations"`
+	}
+
+	WebhookAttempt struct {
+		Timestamp  int64  `json:"timestamp"`
+		StatusCode int    `json:"statusCode"`
+		Error      string `json:"error,omitempty"`
+	}
+
+	DecodedTransaction struct {
+		Id                    string                           `json:"id"`
+		Type                  string                           `json:"type"`
+		Size                  uint64                           `json:"size"`
+		ScpInputs             []DecodedScpInput                `json:"scpInputs"`
+		ScpOutputs            []DecodedScpOutput               `json:"scpOutputs"`
+		MinerFees             []DecodedAmount                  `json:"minerFees"`
+		TotalFee              DecodedAmount                    `json:"totalFee"`
+		SpfInputs             []DecodedSpfInput                `json:"spfInputs"`
+		SpfOutputs            []spdbridge.SpfOutput            `json:"spfOutputs"`
+		FileContracts         []spdbridge.FileContract         `json:"fileContracts"`
+		FileContractRevisions []spdbridge.FileContractRevision `json:"fileContractRevisions"`
+		StorageProofs         []DecodedStorageProof            `json:"storageProofs"`
+		ArbitraryData         []DecodedArbitraryData           `json:"arbitraryData"`
+		Signatures            []DecodedSignature               `json:"signatures"`
+	}
+
+	DecodedAmount struct {
+		Value string `json:"value"`
+		Scp   string `json:"scp"`
+	}
+
+	DecodedScpInput struct {
+		ParentId         string                     `json:"parentId"`
+		Address          string                     `json:"address"`
+		UnlockConditions spdbridge.UnlockConditions `json:"unlockConditions"`
+	}
+
+	DecodedScpOutput struct {
+		Id      string `json:"id"`
+		Address string `json:"address"`
+		DecodedAmount
+	}
+
+	DecodedSpfInput struct {
+		ParentId         string                     `json:"parentId"`
+		Address          string                     `json:"address"`
+		ClaimAddress     string                     `json:"claimAddress"`
+		UnlockConditions spdbridge.UnlockConditions `json:"unlockConditions"`
+	}
+
+	DecodedStorageProof struct {
+		ParentId string   `json:"parentId"`
+		Segment  string   `json:"segment"`
+		HashSet  []string `json:"hashSet"`
+	}
+
+	DecodedArbitraryData struct {
+		Hex  string `json:"hex"`
+		Text string `json:"text,omitempty"`
+	}
+
+	DecodedSignature struct {
+		ParentId       string                  `json:"parentId"`
+		PublicKeyIndex uint64                  `json:"publicKeyIndex"`
+		Timelock       uint64                  `json:"timelock"`
+		CoveredFields  spdbridge.CoveredFields `json:"coveredFields"`
+		Signature      string                  `json:"signature"`
+	}
+
+	SpfBalancesResp struct {
+		Addresses []SpfBalance `json:"addresses"`
+	}
+
+	SpfBalance struct {
+		Address string `json:"address"`
+		Balance string `json:"balance"`
+		//UnconfirmedBalance includes the transactions waiting in the pool
+		UnconfirmedBalance string             `json:"unconfirmedBalance"`
+		Outputs            []SpfBalanceOutput `json:"outputs"`
+	}
+
+	SpfBalanceOutput struct {
+		Id     string `json:"id"`
+		Value  string `json:"value"`
+		Height uint64 `json:"height"`
+	}
+
+	BlockResp struct {
+		Id             string             `json:"id"`
+		Height         uint64             `json:"height"`
+		ParentId       string             `json:"parentId"`
+		Timestamp      uint64             `json:"timestamp"`
+		Difficulty     string             `json:"difficulty"`
+		MinerPayouts   []BlockMinerPayout `json:"minerPayouts"`
+		TransactionIds []string           `json:"transactionIds"`
+		Confirmations  uint64             `json:"confirmations"`
+	}
+
+	BlockMinerPayout struct {
+		Id             string `json:"id"`
+		Value          string `json:"value"`
+		Address        string `json:"address"`
+		MaturityHeight uint64 `json:"maturityHeight"`
+	}
+
+	BlocksResp struct {
+		Height uint64      `json:"height"`
+		Blocks []BlockResp `json:"blocks"`
+	}
+
+	FeePoolSample struct {
+		Time             int64  `json:"time"`
+		Transactions     int    `json:"transactions"`
+		Size             uint64 `json:"size"`
+		MedianFeePerByte string `json:"medianFeePerByte"`
+	}
+
 	BroadcastData struct {
 		Parents     string `json:"parents"`
 		Transaction string `json:"transaction"`
@@ -45,13 +389,24 @@ type (
 		Height         uint64                `json:"height"`
 		BlockTimestamp uint64                `json:"blocktimestamp"`
 		Id             string                `json:"id"`
+		//Type is the classification of the transaction, see classifyTransaction
+		Type string `json:"type"`
+		//MaturityHeight is set for the miner payouts, which can't be spent before that height
+		MaturityHeight uint64 `json:"maturityheight,omitempty"`
+
+		//The remaining fields are returned from fullTransactionsVersion
+		SpfInputs             []spdbridge.SpfInput             `json:"siafundinputs,omitempty"`
+		SpfOutputs            []spdbridge.SpfOutput            `json:"siafundoutputs,omitempty"`
+		FileContracts         []spdbridge.FileContract         `json:"filecontracts,omitempty"`
+		FileContractRevisions []spdbridge.FileContractRevision `json:"filecontractrevisions,omitempty"`
+		StorageProofs         []spdbridge.StorageProof         `json:"storageproofs,omitempty"`
+		ArbitraryData         [][]byte                         `json:"arbitrarydata,omitempty"`
+		TransactionSignatures []spdbridge.TransactionSignature `json:"transactionsignatures,omitempty"`
 	}
 )
 
 func newTransactionFromExplorer(eT spdbridge.ExplorerTransaction) (t Transaction) {
-	t.ScpInputs = eT.RawTransaction.ScpInputs
-	t.ScpOutputs = eT.RawTransaction.ScpOutputs
-	t.MinerFees = eT.RawTransaction.MinerFees
+	t = newTransactionFromUnconfirmed(eT.RawTransaction)
 	t.Id = eT.Id
 	t.BlockTimestamp = eT.BlockTimestamp
 	t.Height = eT.Height
@@ -62,5 +417,31 @@ func newTransactionFromUnconfirmed(rT spdbridge.RawTransaction) (t Transaction)
 	t.ScpInputs = rT.ScpInputs
 	t.ScpOutputs = rT.ScpOutputs
 	t.MinerFees = rT.MinerFees
+	t.SpfInputs = rT.SpfInputs
+	t.SpfOutputs = rT.SpfOutputs
+	t.FileContracts = rT.FileContracts
+	t.FileContractRevisions = rT.FileContractRevisions
+	t.StorageProofs = rT.StorageProofs
+	t.ArbitraryData = rT.ArbitraryData
+	t.TransactionSignatures = rT.TransactionSignatures
+	t.Type = classifyTransaction(rT)
 	return t
 }
+
+//forVersion returns the transaction as exposed by the API version, versions before fullTransactionsVersion only
+//include the SCP inputs and outputs and the miner fees
+func (t Transaction) forVersion(version int) Transaction {
+	if version >= fullTransactionsVersion {
+		return t
+	}
+	return Transaction{
+		ScpInputs:      t.ScpInputs,
+		ScpOutputs:     t.ScpOutputs,
+		MinerFees:      t.MinerFees,
+		Height:         t.Height,
+		BlockTimestamp: t.BlockTimestamp,
+		Id:             t.Id,
+		Type:           t.Type,
+		MaturityHeight: t.MaturityHeight,
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"io/ioutil"
+	"net/http"
+	"scp-app-api/spdbridge"
+	"sort"
+)
+
+const (
+	ed25519Algorithm    = "ed25519"
+	ed25519PublicKeyLen = 32
+)
+
+const outputTransaction = "transaction"
+
+var errInvalidUnlockConditions = errors.New("invalid unlock conditions")
+
+//newUnlockConditionsHandler handles requests to /unlockconditions
+//Builds the unlock conditions of a multisig and/or timelocked address from the public keys, the number of signatures
+//required and the timelock provided, and returns them with their address
+func newUnlockConditionsHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+
+	var params UnlockConditionsParams
+	err = json.Unmarshal(body, &params)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+
+	unlockConditions := spdbridge.UnlockConditions{
+		Timelock:           params.Timelock,
+		SignaturesRequired: params.SignaturesRequired,
+	}
+	for _, key := range params.PublicKeys {
+		unlockConditions.PublicKeys = append(unlockConditions.PublicKeys, spdbridge.ScpPublicKey{Algorithm: ed25519Algorithm, Key: key})
+	}
+	address, err := unlockConditionsAddress(unlockConditions)
+	if err != nil {
+		http.Error(w, failResponse(err.Error()), 400)
+		return
+	}
+
+	resp := UnlockConditionsResp{UnlockConditions: unlockConditions, Address: address}
+	if data := networkData; data != nil {
+		resp.Spendable = unlockConditions.Timelock <= data.ConsensusHeight
+	}
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//unlockConditionsAddress checks that the unlock conditions can be satisfied, with 1 to len(PublicKeys) signatures
+//required from valid ed25519 keys, and returns their address
+func unlockConditionsAddress(unlockConditions spdbridge.UnlockConditions) (string, error) {
+
+	if unlockConditions.SignaturesRequired == 0 || unlockConditions.SignaturesRequired > uint64(len(unlockConditions.PublicKeys)) {
+		return "", errInvalidUnlockConditions
+	}
+	seen := make(map[string]struct{})
+	for _, publicKey := range unlockConditions.PublicKeys {
+		key, err := base64.StdEncoding.DecodeString(publicKey.Key)
+		if err != nil || len(key) != ed25519PublicKeyLen || publicKey.Algorithm != ed25519Algorithm {
+			return "", errInvalidUnlockConditions
+		}
+		if _, ok := seen[publicKey.Key]; ok {
+			return "", errInvalidUnlockConditions
+		}
+		seen[publicKey.Key] = struct{}{}
+	}
+	return unlockConditions.UnlockHash()
+
+}
+
+//getOutputsBatchHandler handles requests to /addresses/outputs/batch
+//Returns the unspent SCP outputs of the addresses requested, and of the addresses of the unlock conditions provided,
+//telling whether each output can be spent at the current consensus height
+func getOutputsBatchHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+
+	var params OutputsBatchParams
+	err = json.Unmarshal(body, &params)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+	conditions := make(map[string]spdbridge.UnlockConditions)
+	for _, unlockConditions := range params.UnlockConditions {
+		address, err := unlockConditions.UnlockHash()
+		if err != nil {
+			http.Error(w, failResponse(errInvalidUnlockConditions.Error()), 400)
+			return
+		}
+		conditions[address] = unlockConditions
+		params.Addresses = append(params.Addresses, address)
+	}
+	params.Addresses = uniqueStrings(params.Addresses)
+
+	data, err := GetNetworkData()
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), batchRequestTimeout)
+	defer cancel()
+
+	explorerAddresses, pool, err := GetAddressesAndPool(ctx, params.Addresses)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	jsonResp, err := json.Marshal(unspentOutputs(params.Addresses, conditions, explorerAddresses, pool, data.ConsensusHeight))
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//unspentOutputs finds the SCP outputs, the miner payouts and the contract payouts to the addresses which no confirmed
+//transaction spends. The unlock conditions of an address are taken from conditions or, when missing, from the inputs
+//which have spent from it before. An output is spendable once its timelock and its maturity height are reached, if no
+//transaction in the pool spends it already. Without unlock conditions the timelock is unknown, so the output isn't
+//spendable
+func unspentOutputs(addresses []string, conditions map[string]spdbridge.UnlockConditions, explorerAddresses *spdbridge.AddressesBatchResp, pool *transactionPoolSnapshot, height uint64) OutputsBatchResp {
+
+	requested := make(map[string]struct{})
+	known := make(map[string]spdbridge.UnlockConditions)
+	for _, address := range addresses {
+		requested[address] = struct{}{}
+		if unlockConditions, ok := conditions[address]; ok {
+			known[address] = unlockConditions
+		}
+	}
+
+	created := make(map[string]UnspentOutput)
+	spent := make(map[string]struct{})
+	for _, explorerAddress := range explorerAddresses.Addresses {
+		for _, explorerTransaction := range explorerAddress.Transactions {
+			transaction := spdbridge.Transaction(explorerTransaction.RawTransaction)
+			for i, output := range transaction.ScpOutputs {
+				if _, ok := requested[output.UnlockHash]; !ok {
+					continue
+				}
+				id, err := transaction.ScpOutputId(uint64(i))
+				if err != nil {
+					continue
+				}
+				created[id] = UnspentOutput{Id: id, Address: output.UnlockHash, Value: output.Value, Height: explorerTransaction.Height, Source: outputTransaction}
+			}
+			for _, input := range transaction.ScpInputs {
+				spent[input.ParentId] = struct{}{}
+				address, err := input.UnlockConditions.UnlockHash()
+				if err != nil {
+					continue
+				}
+				if _, ok := known[address]; !ok {
+					known[address] = input.UnlockConditions
+				}
+			}
+		}
+		for _, block := range explorerAddress.Blocks {
+			for i, payout := range block.RawBlock.MinerPayouts {
+				if _, ok := requested[payout.UnlockHash]; !ok || i >= len(block.MinerPayoutIds) {
+					continue
+				}
+				created[block.MinerPayoutIds[i]] = UnspentOutput{
+					Id:             block.MinerPayoutIds[i],
+					Address:        payout.UnlockHash,
+					Value:          payout.Value,
+					Height:         block.Height,
+					Source:         transactionMinerPayout,
+					MaturityHeight: block.Height + maturityDelay,
+				}
+			}
+		}
+		for _, payout := range explorerAddress.ContractPayouts {
+			source := transactionMissedProofPayout
+			if payout.ValidProof {
+				source = transactionStorageProofPayout
+			}
+			for i, output := range payout.Outputs {
+				if _, ok := requested[output.UnlockHash]; !ok || i >= len(payout.OutputIds) {
+					continue
+				}
+				created[payout.OutputIds[i]] = UnspentOutput{
+					Id:             payout.OutputIds[i],
+					Address:        output.UnlockHash,
+					Value:          output.Value,
+					Height:         payout.Height,
+					Source:         source,
+					MaturityHeight: payout.Height + maturityDelay,
+				}
+			}
+		}
+	}
+
+	pendingSpent := make(map[string]struct{})
+	for _, transaction := range pool.Transactions {
+		for _, input := range transaction.ScpInputs {
+			pendingSpent[input.ParentId] = struct{}{}
+		}
+	}
+
+	resp := OutputsBatchResp{Height: height, Outputs: []UnspentOutput{}}
+	for id, output := range created {
+		if _, ok := spent[id]; ok {
+			continue
+		}
+		if unlockConditions, ok := known[output.Address]; ok {
+			output.UnlockConditions = &unlockConditions
+			output.Timelock = unlockConditions.Timelock
+		}
+		_, output.PendingSpent = pendingSpent[id]
+		output.Spendable = output.UnlockConditions != nil && output.Timelock <= height && output.MaturityHeight <= height && !output.PendingSpent
+		resp.Outputs = append(resp.Outputs, output)
+	}
+	sort.Slice(resp.Outputs, func(i, j int) bool {
+		if resp.Outputs[i].Height != resp.Outputs[j].Height {
+			return resp.Outputs[i].Height < resp.Outputs[j].Height
+		}
+		return resp.Outputs[i].Id < resp.Outputs[j].Id
+	})
+	return resp
+
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"scp-app-api/spdbridge"
+	"strings"
+	"testing"
+)
+
+const (
+	testKey0 = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	testKey1 = "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+	testKey2 = "AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI="
+)
+
+func TestNewUnlockConditions(t *testing.T) {
+
+	originalData := networkData
+	networkData = &NetworkData{ConsensusHeight: 100}
+	defer func() {
+		networkData = originalData
+	}()
+
+	create := func(body string) (int, UnlockConditionsResp) {
+		recorder := httptest.NewRecorder()
+		newUnlockConditionsHandler(recorder, httptest.NewRequest("POST", "/v1/unlockconditions", strings.NewReader(body)), nil)
+		var resp UnlockConditionsResp
+		json.Unmarshal(recorder.Body.Bytes(), &resp)
+		return recorder.Code, resp
+	}
+
+	statusCode, resp := create(`{"publicKeys":["` + testKey0 + `","` + testKey1 + `","` + testKey2 + `"],"signaturesRequired":2,"timelock":150}`)
+	if statusCode != 200 || len(resp.UnlockConditions.PublicKeys) != 3 || resp.UnlockConditions.SignaturesRequired != 2 || resp.Spendable {
+		t.Fatalf("unexpected response %v %+v", statusCode, resp)
+	}
+	address, _ := resp.UnlockConditions.UnlockHash()
+	if resp.Address != address || spdbridge.ValidateAddress(resp.Address) != nil {
+		t.Fatalf("unexpected address %v", resp.Address)
+	}
+
+	//The standard single key address is the same of any wallet
+	_, single := create(`{"publicKeys":["` + testKey0 + `"],"signaturesRequired":1}`)
+	standard, _ := spdbridge.UnlockConditions{SignaturesRequired: 1, PublicKeys: []spdbridge.ScpPublicKey{{Algorithm: "ed25519", Key: testKey0}}}.UnlockHash()
+	if single.Address != standard || !single.Spendable {
+		t.Fatalf("unexpected single key address %+v", single)
+	}
+
+	for _, body := range []string{
+		`{"publicKeys":["` + testKey0 + `"],"signaturesRequired":2}`,
+		`{"publicKeys":["` + testKey0 + `"],"signaturesRequired":0}`,
+		`{"publicKeys":["` + testKey0 + `","` + testKey0 + `"],"signaturesRequired":1}`,
+		`{"publicKeys":["AQID"],"signaturesRequired":1}`,
+		`{"publicKeys":[],"signaturesRequired":1}`,
+	} {
+		if statusCode, _ := create(body); statusCode != 400 {
+			t.Fatalf("expected status 400 for %v, got %v", body, statusCode)
+		}
+	}
+
+}
+
+func TestUnspentOutputs(t *testing.T) {
+
+	multisig := spdbridge.UnlockConditions{Timelock: 150, SignaturesRequired: 2, PublicKeys: []spdbridge.ScpPublicKey{
+		{Algorithm: "ed25519", Key: testKey0}, {Algorithm: "ed25519", Key: testKey1},
+	}}
+	multisigAddress, _ := multisig.UnlockHash()
+	single := spdbridge.UnlockConditions{SignaturesRequired: 1, PublicKeys: []spdbridge.ScpPublicKey{{Algorithm: "ed25519", Key: testKey2}}}
+	singleAddress, _ := single.UnlockHash()
+
+	funding := spdbridge.RawTransaction{ScpOutputs: []spdbridge.ScpOutput{
+		{Value: "10", UnlockHash: multisigAddress}, {Value: "20", UnlockHash: singleAddress}, {Value: "30", UnlockHash: singleAddress},
+	}}
+	fundingTransaction := spdbridge.Transaction(funding)
+	multisigId, _ := fundingTransaction.ScpOutputId(0)
+	spentId, _ := fundingTransaction.ScpOutputId(1)
+	pendingId, _ := fundingTransaction.ScpOutputId(2)
+	spending := spdbridge.RawTransaction{ScpInputs: []spdbridge.ScpInput{{ParentId: spentId, UnlockConditions: single}}}
+
+	explorerAddresses := &spdbridge.AddressesBatchResp{Addresses: []spdbridge.ExplorerAddress{
+		{Address: singleAddress, Transactions: []spdbridge.ExplorerTransaction{
+			{RawTransaction: funding, Id: "funding", Height: 10},
+			{RawTransaction: spending, Id: "spending", Height: 11},
+		}, Blocks: []spdbridge.ExplorerBlock{{
+			BlockId:        "block",
+			Height:         20,
+			MinerPayoutIds: []string{"payout"},
+			RawBlock:       spdbridge.ExplorerRawBlock{MinerPayouts: []spdbridge.ScpOutput{{Value: "40", UnlockHash: singleAddress}}},
+		}}},
+		{Address: multisigAddress, Transactions: []spdbridge.ExplorerTransaction{{RawTransaction: funding, Id: "funding", Height: 10}}},
+	}}
+	pool := newTransactionPoolSnapshot(&spdbridge.TransactionPoolResp{Transactions: []spdbridge.RawTransaction{{
+		ScpInputs: []spdbridge.ScpInput{{ParentId: pendingId, UnlockConditions: single}},
+	}}})
+
+	conditions := map[string]spdbridge.UnlockConditions{multisigAddress: multisig}
+	resp := unspentOutputs([]string{singleAddress, multisigAddress}, conditions, explorerAddresses, pool, 160)
+	if resp.Height != 160 || len(resp.Outputs) != 3 {
+		t.Fatalf("unexpected outputs %+v", resp)
+	}
+	byId := make(map[string]UnspentOutput)
+	for _, output := range resp.Outputs {
+		byId[output.Id] = output
+	}
+	if output := byId[multisigId]; output.Timelock != 150 || !output.Spendable || output.UnlockConditions == nil {
+		t.Fatalf("unexpected multisig output %+v", output)
+	}
+	//The unlock conditions of the single key address are known from the input spending from it
+	if output := byId[pendingId]; !output.PendingSpent || output.Spendable || output.UnlockConditions == nil {
+		t.Fatalf("unexpected pending output %+v", output)
+	}
+	if output := byId["payout"]; output.Source != transactionMinerPayout || output.MaturityHeight != 164 || output.Spendable {
+		t.Fatalf("unexpected payout %+v", output)
+	}
+
+	resp = unspentOutputs([]string{multisigAddress}, conditions, explorerAddresses, pool, 140)
+	if len(resp.Outputs) != 1 || resp.Outputs[0].Spendable {
+		t.Fatalf("expected the timelocked output not to be spendable, got %+v", resp.Outputs)
+	}
+
+	//Without the unlock conditions the timelock of the multisig address is unknown
+	resp = unspentOutputs([]string{multisigAddress}, nil, explorerAddresses, pool, 160)
+	if len(resp.Outputs) != 1 || resp.Outputs[0].UnlockConditions != nil || resp.Outputs[0].Spendable {
+		t.Fatalf("expected the output with unknown unlock conditions not to be spendable, got %+v", resp.Outputs)
+	}
+
+}
+
+func TestMultisigPoolAttribution(t *testing.T) {
+
+	multisig := spdbridge.UnlockConditions{SignaturesRequired: 2, PublicKeys: []spdbridge.ScpPublicKey{
+		{Algorithm: "ed25519", Key: testKey0}, {Algorithm: "ed25519", Key: testKey1},
+	}}
+	multisigAddress, _ := multisig.UnlockHash()
+	pool := newTransactionPoolSnapshot(&spdbridge.TransactionPoolResp{Transactions: []spdbridge.RawTransaction{
+		{ScpOutputs: []spdbridge.ScpOutput{{Value: "1", UnlockHash: multisigAddress}}},
+		{ScpInputs: []spdbridge.ScpInput{{ParentId: "spent", UnlockConditions: multisig}}},
+		{FileContractRevisions: []spdbridge.FileContractRevision{{ParentId: "contract", UnlockConditions: multisig}}},
+		{ScpOutputs: []spdbridge.ScpOutput{{Value: "1", UnlockHash: "other"}}},
+	}})
+
+	params := TransactionsBatchParams{UnlockConditions: []spdbridge.UnlockConditions{multisig}}
+	if err := params.addUnlockConditions(); err != nil {
+		t.Fatal(err)
+	}
+	result := filterTransactions(params, &spdbridge.AddressesBatchResp{}, pool)
+	if len(result.Transactions) != 3 {
+		t.Fatalf("expected the transactions paying, spending and revising with the multisig, got %+v", result.Transactions)
+	}
+
+	//A single participant's key is enough to attribute the spending transaction
+	result = filterTransactions(TransactionsBatchParams{PublicKeys: []string{testKey1}}, &spdbridge.AddressesBatchResp{}, pool)
+	if len(result.Transactions) != 2 {
+		t.Fatalf("expected 2 transactions, got %+v", result.Transactions)
+	}
+
+	params = TransactionsBatchParams{UnlockConditions: []spdbridge.UnlockConditions{{PublicKeys: []spdbridge.ScpPublicKey{{Key: "not base64"}}}}}
+	if err := params.addUnlockConditions(); err == nil {
+		t.Fatal("expected an error for invalid unlock conditions")
+	}
+
+}
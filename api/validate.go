@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"scp-app-api/spdbridge"
+)
+
+const (
+	inputUnspent   = "unspent"
+	inputFromSet   = "fromSet"
+	inputMissing   = "missing"
+	inputSpent     = "spent"
+	inputPending   = "pendingSpent"
+	inputDuplicate = "duplicate"
+	inputUnknown   = "unknown"
+)
+
+//validateTransactionHandler handles requests to /transactions/validate
+//Checks the transaction set provided, in the same formats accepted by /transactions, without broadcasting it and
+//returns a report with the ids, fees and size of the transactions and the state of the outputs they spend
+func validateTransactionHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+
+	var newTransaction NewTransactionParams
+	err = json.Unmarshal(body, &newTransaction)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+	transactionSet, err := prepareTransactionSet(&newTransaction)
+	if err != nil {
+		http.Error(w, failResponse(err.Error()), 400)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), batchRequestTimeout)
+	defer cancel()
+
+	resp, err := validateTransactionSet(ctx, newTransaction.ValidateData, transactionSet)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//validateTransactionSet runs spd's consensus validation of the set and checks its fee, the outputs spent by its
+//inputs and its timelocks against the current height
+func validateTransactionSet(ctx context.Context, validateData string, transactionSet []spdbridge.Transaction) (*TransactionValidationResp, error) {
+
+	networkData, err := GetNetworkData()
+	if err != nil {
+		return nil, err
+	}
+	fees, err := spdbridge.GetTransactionPoolFees()
+	if err != nil {
+		return nil, err
+	}
+	minFeePerByte, ok := new(big.Int).SetString(fees.MinFee, 10)
+	if !ok {
+		minFeePerByte = new(big.Int)
+	}
+	pool, err := GetTransactionPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pendingSpent := make(map[string]struct{})
+	for _, transaction := range pool.Transactions {
+		for _, input := range transaction.ScpInputs {
+			pendingSpent[input.ParentId] = struct{}{}
+		}
+	}
+
+	resp := TransactionValidationResp{Valid: true, ConsensusValid: true, Errors: []string{}}
+	//spd rejects invalid sets with a 400, any other failure means the set couldn't be validated
+	_, err = spdbridge.ConsensusValidateTxns([]byte(validateData))
+	if err != nil && !spdbridge.IsBadRequest(err) {
+		return nil, err
+	} else if err != nil {
+		resp.ConsensusValid = false
+		resp.ConsensusError = err.Error()
+		resp.Valid = false
+	}
+
+	totalFee := new(big.Int)
+	setOutputs := make(map[string]struct{})
+	setSpent := make(map[string]struct{})
+	for i := range transactionSet {
+		transaction := &transactionSet[i]
+		encoded, err := spdbridge.EncodeTransaction(*transaction)
+		if err != nil {
+			return nil, err
+		}
+		id, err := transaction.Id()
+		if err != nil {
+			return nil, err
+		}
+		validated := ValidatedTransaction{Id: id, Size: uint64(len(encoded)), Inputs: []ValidatedInput{}}
+
+		fee := new(big.Int)
+		for _, minerFee := range transaction.MinerFees {
+			if value, ok := new(big.Int).SetString(minerFee, 10); ok {
+				fee.Add(fee, value)
+			}
+		}
+		validated.Fee = fee.String()
+		totalFee.Add(totalFee, fee)
+		resp.Size += validated.Size
+
+		for _, input := range transaction.ScpInputs {
+			validatedInput := ValidatedInput{
+				ParentId: input.ParentId,
+				Timelock: input.UnlockConditions.Timelock,
+				Unlocked: input.UnlockConditions.Timelock <= networkData.ConsensusHeight,
+			}
+			if _, ok := setSpent[input.ParentId]; ok {
+				validatedInput.Status = inputDuplicate
+			} else if _, ok := setOutputs[input.ParentId]; ok {
+				validatedInput.Status = inputFromSet
+			} else {
+				validatedInput.Status = confirmedOutputStatus(ctx, input.ParentId)
+				if _, ok := pendingSpent[input.ParentId]; ok && validatedInput.Status == inputUnspent {
+					validatedInput.Status = inputPending
+				}
+			}
+			setSpent[input.ParentId] = struct{}{}
+
+			if validatedInput.Status != inputUnspent && validatedInput.Status != inputFromSet && validatedInput.Status != inputUnknown {
+				resp.Valid = false
+				resp.Errors = append(resp.Errors, "input "+input.ParentId+" of transaction "+id+" is "+validatedInput.Status)
+			}
+			if !validatedInput.Unlocked {
+				resp.Valid = false
+				resp.Errors = append(resp.Errors, "input "+input.ParentId+" of transaction "+id+" is timelocked")
+			}
+			validated.Inputs = append(validated.Inputs, validatedInput)
+		}
+		for _, signature := range transaction.TransactionSignatures {
+			if signature.Timelock > networkData.ConsensusHeight {
+				resp.Valid = false
+				resp.Errors = append(resp.Errors, "signature of "+signature.ParentId+" in transaction "+id+" is timelocked")
+			}
+		}
+
+		for j := range transaction.ScpOutputs {
+			outputId, err := transaction.ScpOutputId(uint64(j))
+			if err != nil {
+				return nil, err
+			}
+			setOutputs[outputId] = struct{}{}
+		}
+		resp.Transactions = append(resp.Transactions, validated)
+	}
+
+	minimumFee := new(big.Int).Mul(minFeePerByte, new(big.Int).SetUint64(resp.Size))
+	resp.TotalFee = totalFee.String()
+	resp.MinimumFee = minimumFee.String()
+	resp.FeePerByte = "0"
+	if resp.Size > 0 {
+		resp.FeePerByte = new(big.Int).Quo(totalFee, new(big.Int).SetUint64(resp.Size)).String()
+	}
+	resp.FeeSufficient = totalFee.Cmp(minimumFee) >= 0
+	if !resp.FeeSufficient {
+		resp.Valid = false
+		resp.Errors = append(resp.Errors, "the fee is lower than the minimum of "+resp.MinimumFee)
+	}
+
+	return &resp, nil
+
+}
+
+//confirmedOutputStatus looks up the SCP output in the spd explorer, telling whether it exists and whether a confirmed
+//transaction already spent it
+func confirmedOutputStatus(ctx context.Context, outputId string) string {
+
+	resp, err := spdbridge.ExplorerHash(ctx, outputId)
+	if spdbridge.IsBadRequest(err) {
+		return inputMissing
+	} else if err != nil || resp.HashType != "siacoinoutputid" {
+		return inputUnknown
+	}
+
+	for _, transaction := range resp.Transactions {
+		for _, input := range transaction.RawTransaction.ScpInputs {
+			if input.ParentId == outputId {
+				return inputSpent
+			}
+		}
+	}
+	return inputUnspent
+
+}
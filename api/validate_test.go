@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"scp-app-api/spdbridge"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidateTransaction(t *testing.T) {
+
+	unspentId := strings.Repeat("1", 64)
+	spentId := strings.Repeat("2", 64)
+	missingId := strings.Repeat("3", 64)
+	pendingSpentId := strings.Repeat("4", 64)
+	lockedId := strings.Repeat("5", 64)
+
+	parent := spdbridge.Transaction{
+		ScpInputs:  []spdbridge.ScpInput{{ParentId: unspentId}},
+		ScpOutputs: []spdbridge.ScpOutput{{Value: "10", UnlockHash: strings.Repeat("0", 76)}},
+	}
+	parentOutputId, _ := parent.ScpOutputId(0)
+	transaction := spdbridge.Transaction{
+		ScpInputs: []spdbridge.ScpInput{
+			{ParentId: parentOutputId},
+			{ParentId: spentId},
+			{ParentId: missingId},
+			{ParentId: pendingSpentId},
+			{ParentId: lockedId, UnlockConditions: spdbridge.UnlockConditions{Timelock: 20}},
+		},
+		MinerFees: []string{"1000"},
+	}
+
+	validateStatus := 400
+	mux := http.NewServeMux()
+	mux.HandleFunc("/consensus/validate/transactionset", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "transaction spends a nonexisting siacoin output", validateStatus)
+	})
+	mux.HandleFunc("/tpool/fee", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(spdbridge.TransactionFeesResp{MinFee: "1", MaxFee: "2"})
+	})
+	mux.HandleFunc("/explorer/hashes/", func(w http.ResponseWriter, r *http.Request) {
+		resp := spdbridge.ExplorerHashResp{HashType: "siacoinoutputid"}
+		switch strings.TrimPrefix(r.URL.Path, "/explorer/hashes/") {
+		case unspentId, pendingSpentId, lockedId:
+		case spentId:
+			resp.Transactions = []spdbridge.ExplorerTransaction{{
+				RawTransaction: spdbridge.RawTransaction{ScpInputs: []spdbridge.ScpInput{{ParentId: spentId}}},
+			}}
+		default:
+			http.Error(w, "unrecognized hash used as input to /explorer/hash", 400)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	fakeSpd(t, mux)
+	originalData := networkData
+	defer func() { networkData = originalData }()
+	networkData = &NetworkData{ConsensusHeight: 10}
+	transactionPoolMutex.Lock()
+	originalPool := transactionPool
+	transactionPool = newTransactionPoolSnapshot(&spdbridge.TransactionPoolResp{Transactions: []spdbridge.RawTransaction{
+		{ScpInputs: []spdbridge.ScpInput{{ParentId: pendingSpentId}}},
+	}})
+	transactionPoolMutex.Unlock()
+	defer func() {
+		transactionPoolMutex.Lock()
+		transactionPool = originalPool
+		transactionPoolMutex.Unlock()
+	}()
+
+	body, _ := json.Marshal(NewTransactionParams{TransactionSet: []spdbridge.Transaction{parent, transaction}})
+	recorder := httptest.NewRecorder()
+	validateTransactionHandler(recorder, httptest.NewRequest("POST", "/v1/transactions/validate", bytes.NewReader(body)), nil)
+	if recorder.Code != 200 {
+		t.Fatalf("expected status 200, got %v %v", recorder.Code, recorder.Body.String())
+	}
+	var resp TransactionValidationResp
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Valid || resp.ConsensusValid || len(resp.Transactions) != 2 {
+		t.Fatalf("unexpected report %+v", resp)
+	}
+	parentEncoded, _ := spdbridge.EncodeTransaction(parent)
+	transactionEncoded, _ := spdbridge.EncodeTransaction(transaction)
+	size := uint64(len(parentEncoded) + len(transactionEncoded))
+	if id, _ := transaction.Id(); resp.Transactions[1].Id != id || resp.Size != size {
+		t.Fatalf("unexpected ids or size %+v", resp)
+	}
+	if resp.TotalFee != "1000" || resp.MinimumFee != strconv.FormatUint(size, 10) || !resp.FeeSufficient ||
+		resp.FeePerByte != strconv.FormatUint(1000/size, 10) {
+		t.Fatalf("unexpected fees %+v", resp)
+	}
+
+	if resp.Transactions[0].Inputs[0].Status != inputUnspent {
+		t.Fatalf("unexpected parent input %+v", resp.Transactions[0].Inputs[0])
+	}
+	expected := []string{inputFromSet, inputSpent, inputMissing, inputPending, inputUnspent}
+	for i, input := range resp.Transactions[1].Inputs {
+		if input.Status != expected[i] {
+			t.Fatalf("expected input %v to be %v, got %v", i, expected[i], input.Status)
+		}
+		if input.Unlocked != (input.ParentId != lockedId) {
+			t.Fatalf("unexpected timelock state of input %v", i)
+		}
+	}
+	if len(resp.Errors) != 4 {
+		t.Fatalf("expected spent, missing, pending and timelocked errors, got %v", resp.Errors)
+	}
+
+	//A set spd fails to validate isn't reported as invalid
+	validateStatus = 503
+	recorder = httptest.NewRecorder()
+	validateTransactionHandler(recorder, httptest.NewRequest("POST", "/v1/transactions/validate", bytes.NewReader(body)), nil)
+	if recorder.Code != 500 {
+		t.Fatalf("expected status 500, got %v %v", recorder.Code, recorder.Body.String())
+	}
+
+}
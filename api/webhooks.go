@@ -0,0 +1,543 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"scp-app-api/spdbridge"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const webhooksFile = "webhooks.json"
+
+const (
+	//webhooksMax caps the webhooks registered, since every change rewrites webhooksFile
+	webhooksMax         = 1000
+	webhookMaxAddresses = 1000
+	//webhookMaxDeliveries is the number of deliveries kept in the history of each webhook
+	webhookMaxDeliveries = 100
+	//webhookRetention is how long a webhook is kept without accepting a delivery or being looked up, so that the
+	//registrations nobody uses don't hold the slots forever
+	webhookRetention     = 30 * 24 * time.Hour
+	webhookPruneInterval = time.Hour
+
+	webhookMaxAttempts      = 10
+	webhookMaxRetryInterval = time.Hour
+	webhookRequestTimeout   = 15 * time.Second
+)
+
+//webhookRetryBaseInterval is the wait after the first failed attempt, it doubles at each following one
+var webhookRetryBaseInterval = 30 * time.Second
+
+const (
+	webhookEventPending   = "pending"
+	webhookEventConfirmed = "confirmed"
+)
+
+const webhookSignatureHeader = "X-Webhook-Signature"
+
+//webhook is a registered webhook, it's persisted in webhooksFile along with its delivery history
+type webhook struct {
+	Id         string            `json:"id"`
+	Url        string            `json:"url"`
+	Addresses  []string          `json:"addresses"`
+	Secret     string            `json:"secret"`
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	//Version is the API version the webhook was registered with, which sets the transaction fields of the payloads
+	Version int `json:"version,omitempty"`
+	//ActiveAt is the last time the webhook was registered, accepted a delivery or was looked up
+	ActiveAt int64 `json:"activeAt"`
+
+	//SeenPool holds the keys of the pool transactions already notified, it's persisted so that they aren't notified
+	//again after a restart
+	SeenPool []string `json:"seenPool,omitempty"`
+}
+
+var webhooks = struct {
+	sync.Mutex
+	hooks map[string]*webhook
+}{hooks: make(map[string]*webhook)}
+
+//allowPrivateWebhooks permits webhooks to local and private network hosts, it's meant for tests only
+var allowPrivateWebhooks = false
+
+//webhookClient refuses to connect to non public addresses, so webhooks can't be used to reach the internal network
+var webhookClient = &http.Client{
+	Timeout: webhookRequestTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: webhookRequestTimeout,
+			Control: webhookDialControl,
+		}).DialContext,
+	},
+}
+
+//StartWebhooks loads the registered webhooks and registers them to the sync loops
+func StartWebhooks() {
+
+	var hooks map[string]*webhook
+	err := loadJSON(webhooksFile, &hooks)
+	if err != nil {
+		fmt.Printf("Error while loading webhooks: %v\n", err)
+	}
+	webhooks.Lock()
+	for id, hook := range hooks {
+		//Webhooks registered before ActiveAt was stored get a full retention
+		if hook.ActiveAt == 0 {
+			hook.ActiveAt = time.Now().Unix()
+		}
+		webhooks.hooks[id] = hook
+	}
+	webhooks.Unlock()
+	go syncWebhooks()
+
+	OnPoolChanged(notifyPendingPayments)
+	OnHeightChanged(func(oldHeight uint64, newHeight uint64) {
+		if oldHeight > 0 {
+			go notifyConfirmedPayments(oldHeight, newHeight)
+		}
+	})
+
+}
+
+func syncWebhooks() {
+
+	pruneWebhooks(time.Now())
+
+	time.Sleep(webhookPruneInterval)
+	go syncWebhooks()
+
+}
+
+//pruneWebhooks removes the webhooks which haven't been active for webhookRetention at now
+func pruneWebhooks(now time.Time) {
+
+	webhooks.Lock()
+	defer webhooks.Unlock()
+
+	pruned := false
+	for id, hook := range webhooks.hooks {
+		if now.After(time.Unix(hook.ActiveAt, 0).Add(webhookRetention)) {
+			delete(webhooks.hooks, id)
+			pruned = true
+		}
+	}
+	if pruned {
+		err := saveWebhooks()
+		if err != nil {
+			fmt.Printf("Error while saving webhooks: %v\n", err)
+		}
+	}
+
+}
+
+//newWebhookHandler handles requests to /webhooks
+//Registers a webhook notified when the addresses provided receive a payment. If no secret is provided
+//one is generated, the secret is returned only by this call
+func newWebhookHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+
+	var params WebhookParams
+	err = json.Unmarshal(body, &params)
+	if err != nil {
+		http.Error(w, standardFailResponse, 400)
+		return
+	}
+
+	hookUrl, err := url.Parse(params.Url)
+	if err != nil || (hookUrl.Scheme != "http" && hookUrl.Scheme != "https") || hookUrl.Host == "" {
+		http.Error(w, failResponse("invalid url"), 400)
+		return
+	}
+	params.Addresses = uniqueStrings(params.Addresses)
+	if len(params.Addresses) == 0 || len(params.Addresses) > webhookMaxAddresses {
+		http.Error(w, failResponse(fmt.Sprintf("between 1 and %d addresses are required", webhookMaxAddresses)), 400)
+		return
+	}
+	for _, address := range params.Addresses {
+		if spdbridge.ValidateAddress(address) != nil {
+			http.Error(w, failResponse("invalid address "+address), 400)
+			return
+		}
+	}
+
+	hook := webhook{
+		Id:        randomId(),
+		Url:       params.Url,
+		Addresses: params.Addresses,
+		Secret:    params.Secret,
+		Version:   apiVersion(ps),
+		ActiveAt:  time.Now().Unix(),
+	}
+	if hook.Secret == "" {
+		hook.Secret = randomId()
+	}
+
+	webhooks.Lock()
+	if len(webhooks.hooks) >= webhooksMax {
+		webhooks.Unlock()
+		http.Error(w, failResponse("too many webhooks"), 503)
+		return
+	}
+	webhooks.hooks[hook.Id] = &hook
+	err = saveWebhooks()
+	webhooks.Unlock()
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	resp := hook.response()
+	resp.Secret = hook.Secret
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//getWebhookHandler handles requests to /webhooks/:id
+//Returns the webhook and its delivery attempts, the lookup keeps the webhook active
+func getWebhookHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	webhooks.Lock()
+	hook, ok := webhooks.hooks[ps.ByName("id")]
+	var resp WebhookResp
+	var err error
+	if ok {
+		//The activity is saved at most once per prune interval, since saving rewrites all the webhooks
+		now := time.Now()
+		if now.Sub(time.Unix(hook.ActiveAt, 0)) > webhookPruneInterval {
+			hook.ActiveAt = now.Unix()
+			err = saveWebhooks()
+		}
+		resp = hook.response()
+	}
+	webhooks.Unlock()
+	if !ok {
+		http.Error(w, standardFailResponse, 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	w.Write(jsonResp)
+}
+
+//deleteWebhookHandler handles DELETE requests to /webhooks/:id
+//Removes the webhook, pending retries are dropped
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	webhooks.Lock()
+	_, ok := webhooks.hooks[ps.ByName("id")]
+	delete(webhooks.hooks, ps.ByName("id"))
+	err := saveWebhooks()
+	webhooks.Unlock()
+	if !ok {
+		http.Error(w, standardFailResponse, 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, standardFailResponse, 500)
+		return
+	}
+
+	fmt.Fprintf(w, standardSuccessResponse)
+}
+
+//notifyPendingPayments notifies the webhooks of the payments entering the transaction pool
+func notifyPendingPayments(snapshot *transactionPoolSnapshot) {
+
+	var payloads []WebhookPayload
+	changed := false
+	webhooks.Lock()
+	for _, hook := range webhooks.hooks {
+		fresh, related := newPoolTransactions(snapshot, hook.Addresses, nil, stringSet(hook.SeenPool))
+		//Without fresh transactions related is a subset of the seen ones, so it only changes if it shrinks
+		if len(fresh) > 0 || len(related) != len(hook.SeenPool) {
+			changed = true
+			hook.SeenPool = make([]string, 0, len(related))
+			for key := range related {
+				hook.SeenPool = append(hook.SeenPool, key)
+			}
+		}
+		for _, i := range fresh {
+			payload := hook.payload(webhookEventPending, newTransactionFromUnconfirmed(snapshot.Transactions[i]))
+			if len(payload.Addresses) > 0 {
+				payloads = append(payloads, payload)
+			}
+		}
+	}
+	if changed {
+		err := saveWebhooks()
+		if err != nil {
+			fmt.Printf("Error while saving webhooks: %v\n", err)
+		}
+	}
+	webhooks.Unlock()
+
+	for _, payload := range payloads {
+		go deliverWebhook(payload)
+	}
+
+}
+
+//notifyConfirmedPayments notifies the webhooks of the payments confirmed in the new blocks
+func notifyConfirmedPayments(oldHeight uint64, newHeight uint64) {
+
+	webhooks.Lock()
+	var addresses []string
+	for _, hook := range webhooks.hooks {
+		addresses = append(addresses, hook.Addresses...)
+	}
+	webhooks.Unlock()
+	if len(addresses) == 0 {
+		return
+	}
+
+	confirmed, err := confirmedTransactions(addresses, oldHeight, newHeight)
+	if err != nil {
+		fmt.Printf("Error while fetching confirmed payments: %v\n", err)
+		return
+	}
+
+	var payloads []WebhookPayload
+	webhooks.Lock()
+	for _, hook := range webhooks.hooks {
+		for _, explorerTransaction := range confirmed {
+			payload := hook.payload(webhookEventConfirmed, newTransactionFromExplorer(explorerTransaction))
+			if len(payload.Addresses) > 0 {
+				payloads = append(payloads, payload)
+			}
+		}
+	}
+	webhooks.Unlock()
+
+	for _, payload := range payloads {
+		go deliverWebhook(payload)
+	}
+
+}
+
+//deliverWebhook sends the payload to its webhook, retrying with exponential backoff until it's accepted,
+//the attempts are exhausted or the webhook is deleted. Every attempt is recorded in the webhook deliveries
+func deliverWebhook(payload WebhookPayload) {
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	for attempt := 0; attempt < webhookMaxAttempts; attempt++ {
+		webhooks.Lock()
+		hook, ok := webhooks.hooks[payload.WebhookId]
+		var hookUrl, secret string
+		if ok {
+			hookUrl, secret = hook.Url, hook.Secret
+		}
+		webhooks.Unlock()
+		if !ok {
+			return
+		}
+
+		statusCode, err := postWebhook(hookUrl, secret, body)
+		result := WebhookAttempt{Timestamp: time.Now().Unix(), StatusCode: statusCode}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		delivered := err == nil && statusCode >= 200 && statusCode < 300
+
+		webhooks.Lock()
+		if hook, ok := webhooks.hooks[payload.WebhookId]; ok {
+			if delivered {
+				hook.ActiveAt = result.Timestamp
+			}
+			hook.recordAttempt(payload, result, delivered)
+			err = saveWebhooks()
+			if err != nil {
+				fmt.Printf("Error while saving webhooks: %v\n", err)
+			}
+		}
+		webhooks.Unlock()
+		if delivered {
+			return
+		}
+
+		time.Sleep(webhookRetryInterval(attempt))
+	}
+
+}
+
+//postWebhook posts the body to the url, signed with the secret
+func postWebhook(hookUrl string, secret string, body []byte) (int, error) {
+
+	req, err := http.NewRequestWithContext(context.Background(), "POST", hookUrl, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhookPayload(secret, body))
+
+	response, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	ioutil.ReadAll(response.Body)
+
+	return response.StatusCode, nil
+
+}
+
+//signWebhookPayload returns the hex encoded HMAC-SHA256 of the body
+func signWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookRetryInterval(attempt int) time.Duration {
+	interval := webhookRetryBaseInterval << uint(attempt)
+	if interval > webhookMaxRetryInterval || interval <= 0 {
+		return webhookMaxRetryInterval
+	}
+	return interval
+}
+
+func webhookDialControl(_ string, address string, _ syscall.RawConn) error {
+
+	if allowPrivateWebhooks {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errors.New("webhook host " + host + " is not a public address")
+	}
+	return nil
+
+}
+
+//payload builds the payload notifying the webhook of the transaction, with the webhook addresses it pays to. The
+//addresses are empty when the transaction doesn't pay them or spends from them
+func (hook *webhook) payload(eventType string, transaction Transaction) WebhookPayload {
+
+	addresses := stringSet(hook.Addresses)
+	var paid []string
+	//The outputs of the transactions spending from the addresses are their change, not payments
+	if !spendsFrom(transaction, addresses) {
+		for _, output := range transaction.ScpOutputs {
+			if _, ok := addresses[output.UnlockHash]; ok {
+				paid = append(paid, output.UnlockHash)
+			}
+		}
+	}
+
+	return WebhookPayload{
+		EventId:     randomId(),
+		WebhookId:   hook.Id,
+		Type:        eventType,
+		Timestamp:   time.Now().Unix(),
+		Addresses:   uniqueStrings(paid),
+		Transaction: transaction.forVersion(hook.Version),
+	}
+
+}
+
+//spendsFrom returns whether one of the SCP inputs of the transaction unlocks one of the addresses
+func spendsFrom(transaction Transaction, addresses map[string]struct{}) bool {
+
+	for _, input := range transaction.ScpInputs {
+		address, err := input.UnlockConditions.UnlockHash()
+		if err != nil {
+			continue
+		}
+		if _, ok := addresses[address]; ok {
+			return true
+		}
+	}
+	return false
+
+}
+
+//recordAttempt adds the attempt to the delivery of the payload, must be called holding the webhooks lock
+func (hook *webhook) recordAttempt(payload WebhookPayload, attempt WebhookAttempt, delivered bool) {
+
+	for i := range hook.Deliveries {
+		if hook.Deliveries[i].EventId == payload.EventId {
+			hook.Deliveries[i].Attempts = append(hook.Deliveries[i].Attempts, attempt)
+			hook.Deliveries[i].Delivered = delivered
+			return
+		}
+	}
+
+	hook.Deliveries = append(hook.Deliveries, WebhookDelivery{
+		EventId:       payload.EventId,
+		Type:          payload.Type,
+		TransactionId: payload.Transaction.Id,
+		Delivered:     delivered,
+		Attempts:      []WebhookAttempt{attempt},
+	})
+	if len(hook.Deliveries) > webhookMaxDeliveries {
+		hook.Deliveries = hook.Deliveries[len(hook.Deliveries)-webhookMaxDeliveries:]
+	}
+
+}
+
+//response returns the webhook as exposed by the API, without its secret
+func (hook *webhook) response() WebhookResp {
+	return WebhookResp{
+		Id:         hook.Id,
+		Url:        hook.Url,
+		Addresses:  hook.Addresses,
+		Deliveries: append([]WebhookDelivery(nil), hook.Deliveries...),
+		ActiveAt:   hook.ActiveAt,
+	}
+}
+
+//saveWebhooks persists the webhooks, must be called holding the webhooks lock
+func saveWebhooks() error {
+	return saveJSON(webhooksFile, webhooks.hooks)
+}
+
+//randomId returns a random 128 bit hex encoded identifier
+func randomId() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
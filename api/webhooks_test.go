@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"scp-app-api/spdbridge"
+	"testing"
+	"time"
+)
+
+const testAddress = "898ffe66dbcddd36cb88fc2808dfea399d77fe2eb253654cbda06a8150651a9b2056b659a987"
+
+func TestWebhookDelivery(t *testing.T) {
+
+	dataDir = t.TempDir()
+	allowPrivateWebhooks = true
+	webhookRetryBaseInterval = 10 * time.Millisecond
+	defer func() {
+		allowPrivateWebhooks = false
+		webhookRetryBaseInterval = 30 * time.Second
+	}()
+
+	type received struct {
+		signature string
+		body      []byte
+	}
+	deliveries := make(chan received, 10)
+	failures := 1
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		//The first attempt fails to exercise the retries
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		deliveries <- received{signature: r.Header.Get(webhookSignatureHeader), body: body}
+	}))
+	defer receiver.Close()
+
+	server := httptest.NewServer(buildRouter())
+	defer server.Close()
+
+	params, _ := json.Marshal(WebhookParams{Url: receiver.URL, Addresses: []string{testAddress}, Secret: "secret"})
+	resp, err := http.Post(server.URL+"/v1/webhooks", "application/json", bytes.NewReader(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hook WebhookResp
+	json.NewDecoder(resp.Body).Decode(&hook)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || hook.Id == "" || hook.Secret != "secret" {
+		t.Fatalf("unexpected registration response %v %+v", resp.StatusCode, hook)
+	}
+
+	invalid, _ := json.Marshal(WebhookParams{Url: receiver.URL, Addresses: []string{"a"}})
+	resp, err = http.Post(server.URL+"/v1/webhooks", "application/json", bytes.NewReader(invalid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Fatalf("expected invalid addresses to be rejected, got %v", resp.StatusCode)
+	}
+
+	snapshot := newTransactionPoolSnapshot(&spdbridge.TransactionPoolResp{Transactions: []spdbridge.RawTransaction{
+		{ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: testAddress, Value: "5"}}},
+	}})
+	notifyPendingPayments(snapshot)
+	notifyPendingPayments(snapshot)
+
+	var delivery received
+	select {
+	case delivery = <-deliveries:
+	case <-time.After(webhookRetryBaseInterval + 5*time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	if delivery.signature != "sha256="+signWebhookPayload("secret", delivery.body) {
+		t.Fatal("invalid signature")
+	}
+	var payload WebhookPayload
+	json.Unmarshal(delivery.body, &payload)
+	if payload.Type != webhookEventPending || payload.WebhookId != hook.Id || payload.Addresses[0] != testAddress {
+		t.Fatalf("unexpected payload %+v", payload)
+	}
+
+	//The notified pool transactions are persisted, so they aren't notified again after a restart
+	var reloaded map[string]*webhook
+	if err := loadJSON(webhooksFile, &reloaded); err != nil || len(reloaded[hook.Id].SeenPool) != 1 {
+		t.Fatalf("expected the seen pool transaction to be persisted, got %v %+v", err, reloaded[hook.Id])
+	}
+	webhooks.Lock()
+	webhooks.hooks = reloaded
+	webhooks.Unlock()
+	notifyPendingPayments(snapshot)
+
+	//The delivery history records both attempts
+	time.Sleep(100 * time.Millisecond)
+	resp, err = http.Get(server.URL + "/v1/webhooks/" + hook.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored WebhookResp
+	json.NewDecoder(resp.Body).Decode(&stored)
+	resp.Body.Close()
+	if stored.Secret != "" || len(stored.Deliveries) != 1 || len(stored.Deliveries[0].Attempts) != 2 || !stored.Deliveries[0].Delivered {
+		t.Fatalf("unexpected deliveries %+v", stored)
+	}
+
+	select {
+	case <-deliveries:
+		t.Fatal("the same pool transaction was notified twice")
+	default:
+	}
+
+	webhooks.Lock()
+	for i := len(webhooks.hooks); i < webhooksMax; i++ {
+		id := randomId()
+		webhooks.hooks[id] = &webhook{Id: id}
+	}
+	webhooks.Unlock()
+	resp, err = http.Post(server.URL+"/v1/webhooks", "application/json", bytes.NewReader(params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	webhooks.Lock()
+	webhooks.hooks = make(map[string]*webhook)
+	webhooks.Unlock()
+	if resp.StatusCode != 503 {
+		t.Fatalf("expected the registration to fail once webhooksMax is reached, got %v", resp.StatusCode)
+	}
+
+}
+
+func TestWebhookPayload(t *testing.T) {
+
+	unlockConditions := spdbridge.UnlockConditions{
+		SignaturesRequired: 1,
+		PublicKeys:         []spdbridge.ScpPublicKey{{Algorithm: ed25519Algorithm, Key: base64.StdEncoding.EncodeToString(make([]byte, ed25519PublicKeyLen))}},
+	}
+	address, err := unlockConditions.UnlockHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hook := webhook{Id: "hook", Addresses: []string{address}}
+
+	for _, test := range []struct {
+		name        string
+		transaction spdbridge.RawTransaction
+		paid        bool
+	}{
+		{"payment", spdbridge.RawTransaction{ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: address, Value: "5"}}}, true},
+		{"change", spdbridge.RawTransaction{
+			ScpInputs:  []spdbridge.ScpInput{{ParentId: "parent", UnlockConditions: unlockConditions}},
+			ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: testAddress, Value: "5"}, {UnlockHash: address, Value: "3"}},
+		}, false},
+		{"spf only", spdbridge.RawTransaction{SpfOutputs: []spdbridge.SpfOutput{{UnlockHash: address, Value: "1"}}}, false},
+	} {
+		payload := hook.payload(webhookEventPending, newTransactionFromUnconfirmed(test.transaction))
+		if (len(payload.Addresses) > 0) != test.paid {
+			t.Fatalf("unexpected addresses for the %v transaction %v", test.name, payload.Addresses)
+		}
+	}
+
+}
+
+func TestPruneWebhooks(t *testing.T) {
+
+	dataDir = t.TempDir()
+	now := time.Now()
+	webhooks.Lock()
+	webhooks.hooks = map[string]*webhook{
+		"active":   {Id: "active", ActiveAt: now.Add(-time.Hour).Unix()},
+		"inactive": {Id: "inactive", ActiveAt: now.Add(-webhookRetention - time.Hour).Unix()},
+	}
+	webhooks.Unlock()
+	defer func() {
+		webhooks.Lock()
+		webhooks.hooks = make(map[string]*webhook)
+		webhooks.Unlock()
+	}()
+
+	pruneWebhooks(now)
+
+	var stored map[string]*webhook
+	if err := loadJSON(webhooksFile, &stored); err != nil || len(stored) != 1 || stored["active"] == nil {
+		t.Fatalf("expected only the active webhook to be kept, got %v %+v", err, stored)
+	}
+
+}
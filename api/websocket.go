@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"scp-app-api/spdbridge"
+	"sync"
+	"time"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 50 * time.Second
+
+	//wsSendBuffer is the number of events queued for a client before it's considered too slow and disconnected
+	wsSendBuffer = 64
+	//wsMaxSubscriptionSize limits the addresses plus public keys a single client can subscribe to
+	wsMaxSubscriptionSize = 2000
+)
+
+const (
+	wsEventBlock        = "block"
+	wsEventTransaction  = "transaction"
+	wsEventConfirmation = "confirmation"
+	wsEventNetworkData  = "networkdata"
+)
+
+const wsSubscribe = "subscribe"
+
+//wsClient is a connected WebSocket client and the addresses it subscribed to
+type wsClient struct {
+	conn      *websocket.Conn
+	send      chan []byte
+	closeOnce sync.Once
+	//version is the API version of the connection, which sets the transaction fields sent
+	version int
+
+	mutex  sync.Mutex
+	params TransactionsBatchParams
+	//seenPool holds the keys of the pool transactions already sent to the client
+	seenPool map[string]struct{}
+}
+
+var wsClients = struct {
+	sync.Mutex
+	clients map[*wsClient]struct{}
+}{clients: make(map[*wsClient]struct{})}
+
+var wsUpgrader = websocket.Upgrader{
+	//The API is public and used by apps, there's no origin to restrict
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+//StartWebSocketHub registers the WebSocket hub to the sync loops, so that the events reach the clients
+func StartWebSocketHub() {
+
+	OnHeightChanged(func(oldHeight uint64, newHeight uint64) {
+		broadcastWsEvent(WsEvent{Type: wsEventBlock, Height: newHeight})
+		//On the first sync there's no previous height to compare to
+		if oldHeight > 0 {
+			go pushConfirmations(oldHeight, newHeight)
+		}
+	})
+	OnPoolChanged(func(snapshot *transactionPoolSnapshot) {
+		for _, client := range connectedWsClients() {
+			client.pushPoolTransactions(snapshot)
+		}
+	})
+	OnNetworkDataChanged(func() {
+		data := buildNetworkDataResponse()
+		broadcastWsEvent(WsEvent{Type: wsEventNetworkData, NetworkData: &data})
+	})
+
+}
+
+//wsHandler handles requests to /ws
+//Upgrades the connection to a WebSocket, the client subscribes to a set of addresses and public keys sending a
+//subscribe message and receives block, transaction, confirmation and network data events
+func wsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		//The upgrader already replied with an error
+		return
+	}
+
+	client := &wsClient{
+		conn:     conn,
+		send:     make(chan []byte, wsSendBuffer),
+		seenPool: make(map[string]struct{}),
+		version:  apiVersion(ps),
+	}
+	wsClients.Lock()
+	wsClients.clients[client] = struct{}{}
+	wsClients.Unlock()
+
+	go client.writePump()
+	client.push(WsEvent{Type: wsEventBlock, Height: currentHeight()})
+	client.readPump()
+
+}
+
+//readPump reads the subscriptions of the client until the connection is closed
+func (c *wsClient) readPump() {
+
+	defer c.close()
+
+	c.conn.SetReadLimit(int64(wsMaxSubscriptionSize) * 128)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		var params WsSubscribeParams
+		err := c.conn.ReadJSON(&params)
+		if err != nil {
+			if _, ok := err.(*websocket.CloseError); !ok && verbose {
+				fmt.Printf("WebSocket read failed: %v\n", err)
+			}
+			return
+		}
+		if params.Type != wsSubscribe || len(params.Addresses)+len(params.PublicKeys) > wsMaxSubscriptionSize {
+			return
+		}
+
+		c.mutex.Lock()
+		addresses := uniqueStrings(append(params.Addresses, keyAddresses(params.PublicKeys)...))
+		c.params = TransactionsBatchParams{Addresses: addresses, PublicKeys: params.PublicKeys}
+		c.seenPool = make(map[string]struct{})
+		c.mutex.Unlock()
+
+		//Transactions already in the pool are sent right away
+		snapshot, err := GetTransactionPool(context.Background())
+		if err == nil {
+			c.pushPoolTransactions(snapshot)
+		}
+	}
+
+}
+
+//keyAddresses returns the standard addresses of the public keys, spendable by the key alone without timelock, which
+//are the addresses confirmations are looked up for when a client subscribes to keys. Invalid keys are skipped
+func keyAddresses(publicKeys []string) []string {
+
+	var addresses []string
+	for _, key := range publicKeys {
+		address, err := unlockConditionsAddress(spdbridge.UnlockConditions{
+			SignaturesRequired: 1,
+			PublicKeys:         []spdbridge.ScpPublicKey{{Algorithm: ed25519Algorithm, Key: key}},
+		})
+		if err == nil {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+
+}
+
+//writePump sends the queued events and keeps the connection alive with pings
+func (c *wsClient) writePump() {
+
+	ticker := time.NewTicker(wsPingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+
+}
+
+//push queues an event for the client, disconnecting it if it can't keep up
+func (c *wsClient) push(event WsEvent) {
+
+	message, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	wsClients.Lock()
+	defer wsClients.Unlock()
+	if _, ok := wsClients.clients[c]; !ok {
+		return
+	}
+	select {
+	case c.send <- message:
+	default:
+		delete(wsClients.clients, c)
+		c.closeOnce.Do(func() { close(c.send) })
+	}
+
+}
+
+//close unregisters the client, the write pump then closes the connection
+func (c *wsClient) close() {
+
+	wsClients.Lock()
+	defer wsClients.Unlock()
+	delete(wsClients.clients, c)
+	c.closeOnce.Do(func() { close(c.send) })
+
+}
+
+//pushPoolTransactions sends the pool transactions related to the client subscription which haven't been sent yet
+func (c *wsClient) pushPoolTransactions(snapshot *transactionPoolSnapshot) {
+
+	c.mutex.Lock()
+	params := c.params
+	fresh, related := newPoolTransactions(snapshot, params.Addresses, params.PublicKeys, c.seenPool)
+	//Transactions leaving the pool are forgotten, they will be sent as confirmations
+	c.seenPool = related
+	c.mutex.Unlock()
+
+	var transactions []Transaction
+	for _, i := range fresh {
+		transactions = append(transactions, newTransactionFromUnconfirmed(snapshot.Transactions[i]))
+	}
+	if c.version < fullTransactionsVersion {
+		transactions = withoutSpfOnly(transactions, params.Addresses, params.PublicKeys)
+	}
+	for _, transaction := range transactions {
+		transaction = transaction.forVersion(c.version)
+		c.push(WsEvent{Type: wsEventTransaction, Transaction: &transaction})
+	}
+
+}
+
+//pushConfirmations sends to each client the transactions related to its subscription confirmed in the new blocks
+func pushConfirmations(oldHeight uint64, newHeight uint64) {
+
+	for _, client := range connectedWsClients() {
+		client.mutex.Lock()
+		params := client.params
+		client.mutex.Unlock()
+		if len(params.Addresses) == 0 {
+			continue
+		}
+
+		confirmed, err := confirmedTransactions(params.Addresses, oldHeight, newHeight)
+		if err != nil {
+			if verbose {
+				fmt.Printf("Error while fetching confirmations: %v\n", err)
+			}
+			continue
+		}
+		var transactions []Transaction
+		for _, explorerTransaction := range confirmed {
+			transactions = append(transactions, newTransactionFromExplorer(explorerTransaction))
+		}
+		if client.version < fullTransactionsVersion {
+			transactions = withoutSpfOnly(transactions, params.Addresses, params.PublicKeys)
+		}
+		for _, transaction := range transactions {
+			transaction = transaction.forVersion(client.version)
+			client.push(WsEvent{Type: wsEventConfirmation, Height: transaction.Height, Transaction: &transaction})
+		}
+	}
+
+}
+
+func broadcastWsEvent(event WsEvent) {
+	for _, client := range connectedWsClients() {
+		client.push(event)
+	}
+}
+
+func connectedWsClients() []*wsClient {
+
+	wsClients.Lock()
+	defer wsClients.Unlock()
+	clients := make([]*wsClient, 0, len(wsClients.clients))
+	for client := range wsClients.clients {
+		clients = append(clients, client)
+	}
+	return clients
+
+}
+
+//currentHeight returns the cached consensus height, or 0 if it's not available yet
+func currentHeight() uint64 {
+
+	data, err := GetNetworkData()
+	if err != nil {
+		return 0
+	}
+	return data.ConsensusHeight
+
+}
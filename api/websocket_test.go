@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/base64"
+	"github.com/gorilla/websocket"
+	"net/http/httptest"
+	"scp-app-api/spdbridge"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebSocketPoolEvents(t *testing.T) {
+
+	networkData = &NetworkData{ConsensusHeight: 42}
+	transactionPool = newTransactionPoolSnapshot(&spdbridge.TransactionPoolResp{})
+	StartWebSocketHub()
+
+	server := httptest.NewServer(buildRouter())
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v1/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var event WsEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != wsEventBlock || event.Height != 42 {
+		t.Fatalf("unexpected first event %+v", event)
+	}
+
+	if err := conn.WriteJSON(WsSubscribeParams{Type: wsSubscribe, Addresses: []string{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	//Wait for the subscription to be processed
+	for i := 0; i < 50; i++ {
+		clients := connectedWsClients()
+		clients[0].mutex.Lock()
+		subscribed := len(clients[0].params.Addresses) > 0
+		clients[0].mutex.Unlock()
+		if subscribed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	paying := spdbridge.RawTransaction{ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: "a", Value: "1"}}}
+	other := spdbridge.RawTransaction{ScpOutputs: []spdbridge.ScpOutput{{UnlockHash: "b", Value: "2"}}}
+	snapshot := newTransactionPoolSnapshot(&spdbridge.TransactionPoolResp{Transactions: []spdbridge.RawTransaction{other, paying}})
+	//The same snapshot twice must produce a single event
+	notifyPoolChanged(snapshot)
+	notifyPoolChanged(snapshot)
+	notifyHeightChanged(0, 43)
+
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != wsEventTransaction || event.Transaction.ScpOutputs[0].Value != "1" {
+		t.Fatalf("unexpected transaction event %+v", event)
+	}
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != wsEventBlock || event.Height != 43 {
+		t.Fatalf("unexpected block event %+v", event)
+	}
+
+}
+
+func TestKeyAddresses(t *testing.T) {
+
+	key := base64.StdEncoding.EncodeToString(make([]byte, ed25519PublicKeyLen))
+	standard, err := unlockConditionsAddress(spdbridge.UnlockConditions{
+		SignaturesRequired: 1,
+		PublicKeys:         []spdbridge.ScpPublicKey{{Algorithm: ed25519Algorithm, Key: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addresses := keyAddresses([]string{key, "notakey"})
+	if len(addresses) != 1 || addresses[0] != standard {
+		t.Fatalf("expected the standard address %v of the key, got %v", standard, addresses)
+	}
+
+}
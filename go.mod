@@ -2,4 +2,13 @@ module scp-app-api
 
 go 1.17
 
-require github.com/julienschmidt/httprouter v1.3.0
+require (
+	github.com/gorilla/websocket v1.5.0
+	github.com/julienschmidt/httprouter v1.3.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
+	golang.org/x/sync v0.0.0-20220907140024-f12130a52804
+)
+
+require golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
@@ -2,6 +2,7 @@ package spdbridge
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +11,8 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 var SpdApiPort = "4280"
@@ -22,9 +25,25 @@ const headerAgent = "ScPrime-Agent"
 
 const verbose = false
 
+//explorerHashConcurrency is the maximum number of concurrent /explorer/hashes requests made by a single batch lookup
+const explorerHashConcurrency = 8
+
+//explorerBatchUnsupported is set once spd has been found to lack the /explorer/addresses/batch endpoint
+var explorerBatchUnsupported int32
+
+//RequestError is returned when spd replies with an unsuccessful status code
+type RequestError struct {
+	Path       string
+	StatusCode int
+}
+
+func (e *RequestError) Error() string {
+	return e.Path + " error " + strconv.Itoa(e.StatusCode)
+}
+
 //GetConsensus performs a GET request ScPrime API endpoint /consensus
 func GetConsensus() (*ConsensusResp, error) {
-	resp, e := getRequest("/consensus")
+	resp, e := getRequest(context.Background(), "/consensus")
 	if e != nil {
 		return nil, e
 	}
@@ -38,9 +57,41 @@ func GetConsensus() (*ConsensusResp, error) {
 	return &data, nil
 }
 
+//GetConsensusBlock performs a GET request ScPrime API endpoint /consensus/blocks for the block at the height provided
+func GetConsensusBlock(height uint64) (*ConsensusBlock, error) {
+	resp, e := getRequest(context.Background(), "/consensus/blocks?height="+strconv.FormatUint(height, 10))
+	if e != nil {
+		return nil, e
+	}
+
+	var data ConsensusBlock
+	e = json.Unmarshal(resp, &data)
+	if e != nil {
+		return nil, e
+	}
+
+	return &data, nil
+}
+
+//GetConsensusBlockById performs a GET request ScPrime API endpoint /consensus/blocks for the block with the id provided
+func GetConsensusBlockById(ctx context.Context, id string) (*ConsensusBlock, error) {
+	resp, e := getRequest(ctx, "/consensus/blocks?id="+url.QueryEscape(id))
+	if e != nil {
+		return nil, e
+	}
+
+	var data ConsensusBlock
+	e = json.Unmarshal(resp, &data)
+	if e != nil {
+		return nil, e
+	}
+
+	return &data, nil
+}
+
 //GetTransactionPoolFees performs a GET request ScPrime API endpoint /tpool/fee
 func GetTransactionPoolFees() (*TransactionFeesResp, error) {
-	resp, e := getRequest("/tpool/fee")
+	resp, e := getRequest(context.Background(), "/tpool/fee")
 	if e != nil {
 		return nil, e
 	}
@@ -54,9 +105,14 @@ func GetTransactionPoolFees() (*TransactionFeesResp, error) {
 	return &data, nil
 }
 
-//GetTransactionPool performs a GET request ScPrime API endpoint /tpool/fee
+//GetTransactionPool performs a GET request ScPrime API endpoint /tpool/transactions
 func GetTransactionPool() (*TransactionPoolResp, error) {
-	resp, e := getRequest("/tpool/transactions")
+	return GetTransactionPoolWithContext(context.Background())
+}
+
+//GetTransactionPoolWithContext is like GetTransactionPool but the request is bound to ctx
+func GetTransactionPoolWithContext(ctx context.Context) (*TransactionPoolResp, error) {
+	resp, e := getRequest(ctx, "/tpool/transactions")
 	if e != nil {
 		return nil, e
 	}
@@ -67,16 +123,72 @@ func GetTransactionPool() (*TransactionPoolResp, error) {
 		return nil, e
 	}
 
+	//The ids and sizes are left empty if any transaction can't be encoded
+	ids := make([]string, 0, len(data.Transactions))
+	sizes := make([]uint64, 0, len(data.Transactions))
+	for i := range data.Transactions {
+		transaction := Transaction(data.Transactions[i])
+		id, err := transaction.Id()
+		if err != nil {
+			break
+		}
+		encoded, err := EncodeTransaction(transaction)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+		sizes = append(sizes, uint64(len(encoded)))
+	}
+	if len(ids) == len(data.Transactions) {
+		data.Ids, data.Sizes = ids, sizes
+	}
+
+	return &data, nil
+}
+
+//GetTransactionPoolRaw performs a GET request ScPrime API endpoint /tpool/raw/:id, returns nil if the
+//transaction is not in the transaction pool
+func GetTransactionPoolRaw(ctx context.Context, id string) (*TransactionPoolRawResp, error) {
+	resp, e := getRequest(ctx, "/tpool/raw/"+url.PathEscape(id))
+	if IsBadRequest(e) {
+		//spd replies with a 400 to transactions which are not in the pool
+		return nil, nil
+	} else if e != nil {
+		return nil, e
+	}
+
+	var data TransactionPoolRawResp
+	e = json.Unmarshal(resp, &data)
+	if e != nil {
+		return nil, e
+	}
+
 	return &data, nil
 }
 
+//TransactionPoolConfirmed performs a GET request ScPrime API endpoint /tpool/confirmed/:id
+func TransactionPoolConfirmed(ctx context.Context, id string) (bool, error) {
+	resp, e := getRequest(ctx, "/tpool/confirmed/"+url.PathEscape(id))
+	if e != nil {
+		return false, e
+	}
+
+	var data TransactionPoolConfirmedResp
+	e = json.Unmarshal(resp, &data)
+	if e != nil {
+		return false, e
+	}
+
+	return data.Confirmed, nil
+}
+
 //TransactionPoolRaw performs a POST request ScPrime API endpoint /tpool/raw
 func TransactionPoolRaw(parents string, transaction string) (bool, error) {
 	requestData := url.Values{}
 	requestData.Set("parents", parents)
 	requestData.Set("transaction", transaction)
 
-	_, e := postRequestForm("/tpool/raw", requestData)
+	_, e := postRequestForm(context.Background(), "/tpool/raw", requestData)
 	if e != nil {
 		return false, e
 	}
@@ -86,7 +198,7 @@ func TransactionPoolRaw(parents string, transaction string) (bool, error) {
 
 //ConsensusValidateTxns performs a POST request ScPrime API endpoint /consensus/validate/transactionset
 func ConsensusValidateTxns(txnsData []byte) (bool, error) {
-	_, e := postRequestJSON("/consensus/validate/transactionset", txnsData)
+	_, e := postRequestJSON(context.Background(), "/consensus/validate/transactionset", txnsData)
 	if e != nil {
 		return false, e
 	}
@@ -94,8 +206,18 @@ func ConsensusValidateTxns(txnsData []byte) (bool, error) {
 	return true, nil
 }
 
-//ExplorerAddressesBatch performs a POST request ScPrime API endpoint /explorer/transactions/batch
+//ExplorerAddressesBatch performs a POST request ScPrime API endpoint /explorer/addresses/batch
 func ExplorerAddressesBatch(addresses []string) (*AddressesBatchResp, error) {
+	return ExplorerAddressesBatchWithContext(context.Background(), addresses)
+}
+
+//ExplorerAddressesBatchWithContext is like ExplorerAddressesBatch but the request is bound to ctx
+//If spd hasn't been patched and the endpoint is missing, the addresses are looked up one by one with /explorer/hashes
+func ExplorerAddressesBatchWithContext(ctx context.Context, addresses []string) (*AddressesBatchResp, error) {
+
+	if atomic.LoadInt32(&explorerBatchUnsupported) == 1 {
+		return explorerAddressesByHash(ctx, addresses)
+	}
 
 	jsonRequest, e := json.Marshal(AddressesBatchParams{
 		Addresses: addresses,
@@ -104,7 +226,14 @@ func ExplorerAddressesBatch(addresses []string) (*AddressesBatchResp, error) {
 		return nil, e
 	}
 
-	resp, e := postRequestJSON("/explorer/addresses/batch", jsonRequest)
+	resp, e := postRequestJSON(ctx, "/explorer/addresses/batch", jsonRequest)
+	var requestError *RequestError
+	if errors.As(e, &requestError) && (requestError.StatusCode == http.StatusNotFound || requestError.StatusCode == http.StatusMethodNotAllowed) {
+		if atomic.CompareAndSwapInt32(&explorerBatchUnsupported, 0, 1) {
+			fmt.Println("spd doesn't expose /explorer/addresses/batch, falling back to /explorer/hashes lookups")
+		}
+		return explorerAddressesByHash(ctx, addresses)
+	}
 	if e != nil {
 		return nil, e
 	}
@@ -118,10 +247,88 @@ func ExplorerAddressesBatch(addresses []string) (*AddressesBatchResp, error) {
 	return &data, nil
 }
 
+//ExplorerHash performs a GET request ScPrime API endpoint /explorer/hashes/:hash
+func ExplorerHash(ctx context.Context, hash string) (*ExplorerHashResp, error) {
+	resp, e := getRequest(ctx, "/explorer/hashes/"+url.PathEscape(hash))
+	if e != nil {
+		return nil, e
+	}
+
+	var data ExplorerHashResp
+	e = json.Unmarshal(resp, &data)
+	if e != nil {
+		return nil, e
+	}
+
+	return &data, nil
+}
+
+//ExplorerTransactionById performs a GET request ScPrime API endpoint /explorer/hashes/:hash for a transaction id,
+//returns nil if the explorer doesn't know the transaction
+func ExplorerTransactionById(ctx context.Context, id string) (*ExplorerTransaction, error) {
+	resp, e := ExplorerHash(ctx, id)
+	if IsBadRequest(e) {
+		return nil, nil
+	} else if e != nil {
+		return nil, e
+	}
+
+	if resp.HashType != "transactionid" {
+		return nil, nil
+	}
+	return &resp.Transaction, nil
+}
+
+//explorerAddressesByHash builds the same response of /explorer/addresses/batch with a /explorer/hashes request
+//for each address, running at most explorerHashConcurrency requests at a time
+func explorerAddressesByHash(ctx context.Context, addresses []string) (*AddressesBatchResp, error) {
+
+	results := make([]*ExplorerHashResp, len(addresses))
+	errs := make([]error, len(addresses))
+	semaphore := make(chan struct{}, explorerHashConcurrency)
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, address string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i], errs[i] = ExplorerHash(ctx, address)
+		}(i, address)
+	}
+	wg.Wait()
+
+	var data AddressesBatchResp
+	for i, address := range addresses {
+		if IsBadRequest(errs[i]) {
+			//spd replies with a 400 to hashes it doesn't know, such as addresses without transactions
+			continue
+		}
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if results[i].HashType == "unlockhash" && (len(results[i].Transactions) > 0 || len(results[i].Blocks) > 0) {
+			data.Addresses = append(data.Addresses, ExplorerAddress{
+				Address:      address,
+				Transactions: results[i].Transactions,
+				Blocks:       results[i].Blocks,
+			})
+		}
+	}
+
+	return &data, nil
+}
+
+//IsBadRequest tells whether spd replied to the request with a 400, which it does when it rejects the request data
+func IsBadRequest(e error) bool {
+	var requestError *RequestError
+	return errors.As(e, &requestError) && requestError.StatusCode == http.StatusBadRequest
+}
+
 //getRequest performs a GET request to ApiURL/path tailored to ScPrime API
-func getRequest(path string) ([]byte, error) {
+func getRequest(ctx context.Context, path string) ([]byte, error) {
 
-	req, e := http.NewRequest("GET", SpdApiURL+":"+SpdApiPort+path, nil)
+	req, e := http.NewRequestWithContext(ctx, "GET", SpdApiURL+":"+SpdApiPort+path, nil)
 	if e != nil {
 		return nil, e
 	}
@@ -149,14 +356,14 @@ func getRequest(path string) ([]byte, error) {
 		return body, nil
 
 	} else {
-		return nil, errors.New(path + " error " + strconv.Itoa(response.StatusCode))
+		return nil, &RequestError{Path: path, StatusCode: response.StatusCode}
 	}
 }
 
 //postRequestJSON performs a POST request with params in a JSON body to ApiURL/path tailored to ScPrime API
-func postRequestJSON(path string, params []byte) ([]byte, error) {
+func postRequestJSON(ctx context.Context, path string, params []byte) ([]byte, error) {
 
-	req, e := http.NewRequest("POST", SpdApiURL+":"+SpdApiPort+path, bytes.NewBuffer(params))
+	req, e := http.NewRequestWithContext(ctx, "POST", SpdApiURL+":"+SpdApiPort+path, bytes.NewBuffer(params))
 	if e != nil {
 		return nil, e
 	}
@@ -183,14 +390,14 @@ func postRequestJSON(path string, params []byte) ([]byte, error) {
 	if response.StatusCode >= 200 && response.StatusCode < 300 {
 		return body, nil
 	} else {
-		return nil, errors.New(path + " error " + strconv.Itoa(response.StatusCode))
+		return nil, &RequestError{Path: path, StatusCode: response.StatusCode}
 	}
 }
 
 //postRequestForm performs a POST request with form params to ApiURL/path tailored to ScPrime API
-func postRequestForm(path string, params url.Values) ([]byte, error) {
+func postRequestForm(ctx context.Context, path string, params url.Values) ([]byte, error) {
 
-	req, e := http.NewRequest("POST", SpdApiURL+":"+SpdApiPort+path, strings.NewReader(params.Encode()))
+	req, e := http.NewRequestWithContext(ctx, "POST", SpdApiURL+":"+SpdApiPort+path, strings.NewReader(params.Encode()))
 	if e != nil {
 		return nil, e
 	}
@@ -217,6 +424,6 @@ func postRequestForm(path string, params url.Values) ([]byte, error) {
 	if response.StatusCode >= 200 && response.StatusCode < 300 {
 		return body, nil
 	} else {
-		return nil, errors.New(path + " error " + strconv.Itoa(response.StatusCode))
+		return nil, &RequestError{Path: path, StatusCode: response.StatusCode}
 	}
 }
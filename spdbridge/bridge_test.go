@@ -0,0 +1,109 @@
+package spdbridge
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+//fakeSpd starts an unpatched spd lookalike and points the bridge to it
+func fakeSpd(t *testing.T, handler http.Handler) {
+
+	server := httptest.NewServer(handler)
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	originalPort := SpdApiPort
+	SpdApiPort = serverURL.Port()
+	t.Cleanup(func() {
+		server.Close()
+		SpdApiPort = originalPort
+		atomic.StoreInt32(&explorerBatchUnsupported, 0)
+	})
+
+}
+
+func TestExplorerAddressesBatchFallback(t *testing.T) {
+
+	var batchCalls int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/explorer/addresses/batch", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&batchCalls, 1)
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/explorer/hashes/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/explorer/hashes/a":
+			w.Write([]byte(`{"hashtype":"unlockhash","transactions":[{"id":"tx1","height":5}]}`))
+		case "/explorer/hashes/b":
+			http.Error(w, `{"message":"unrecognized hash used as input to /explorer/hash"}`, http.StatusBadRequest)
+		default:
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+	})
+	fakeSpd(t, mux)
+
+	for i := 0; i < 2; i++ {
+		resp, err := ExplorerAddressesBatchWithContext(context.Background(), []string{"b", "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Addresses) != 1 || resp.Addresses[0].Address != "a" || resp.Addresses[0].Transactions[0].Id != "tx1" {
+			t.Fatalf("unexpected response %+v", resp)
+		}
+	}
+	if batchCalls != 1 {
+		t.Fatalf("expected the batch endpoint to be tried once, got %v calls", batchCalls)
+	}
+
+	_, err := ExplorerAddressesBatchWithContext(context.Background(), []string{"c"})
+	if err == nil {
+		t.Fatal("expected spd errors to be reported")
+	}
+
+}
+
+func TestExplorerAddressesBatchError(t *testing.T) {
+
+	fakeSpd(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "", http.StatusInternalServerError)
+	}))
+
+	_, err := ExplorerAddressesBatch([]string{"a"})
+	requestError, ok := err.(*RequestError)
+	if !ok || requestError.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected a RequestError with status 500, got %v", err)
+	}
+	if explorerBatchUnsupported != 0 {
+		t.Fatal("fallback enabled on a non 404/405 error")
+	}
+
+}
+
+func TestTransactionPoolIds(t *testing.T) {
+
+	transaction := readTestData(t, "transaction.json")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tpool/transactions", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"transactions":[` + transaction + `,{}]}`))
+	})
+	fakeSpd(t, mux)
+
+	resp, err := GetTransactionPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Transactions) != 2 || len(resp.Ids) != 2 || resp.Ids[0] != testTransactionId || resp.Ids[1] != testEmptyTransactionId {
+		t.Fatalf("unexpected ids %v", resp.Ids)
+	}
+	if encoded, _ := base64.StdEncoding.DecodeString(readTestData(t, "transaction.b64")); resp.Sizes[0] != uint64(len(encoded)) || resp.Sizes[1] != minTransactionLen {
+		t.Fatalf("unexpected sizes %v", resp.Sizes)
+	}
+
+}
@@ -0,0 +1,197 @@
+package spdbridge
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/big"
+	"strings"
+)
+
+//specifierLen is the length of the ScPrime specifiers, such as the signature algorithm of a public key
+const specifierLen = 16
+
+//hashLen is the length of the blake2b hashes used by ScPrime for ids and addresses
+const hashLen = 32
+
+//storageSegmentLen is the length of the file segment proven by a storage proof
+const storageSegmentLen = 64
+
+//encoder writes values using the ScPrime binary encoding
+type encoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *encoder) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) writeUint64(v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	e.write(b[:])
+}
+
+//writePrefixedBytes writes a length-prefixed byte slice
+func (e *encoder) writePrefixedBytes(b []byte) {
+	e.writeUint64(uint64(len(b)))
+	e.write(b)
+}
+
+//writeSpecifier writes s as a fixed length, zero padded specifier
+func (e *encoder) writeSpecifier(s string) {
+	if len(s) > specifierLen {
+		e.setError(errors.New("specifier " + s + " is too long"))
+		return
+	}
+	var b [specifierLen]byte
+	copy(b[:], s)
+	e.write(b[:])
+}
+
+//writeHash writes a hex encoded hash, addresses are accepted too and their checksum is dropped
+func (e *encoder) writeHash(h string) {
+	if len(h) < hashLen*2 {
+		e.setError(errors.New("invalid hash " + h))
+		return
+	}
+	b, err := hex.DecodeString(h[:hashLen*2])
+	if err != nil {
+		e.setError(err)
+		return
+	}
+	e.write(b)
+}
+
+func (e *encoder) setError(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+//writePublicKey writes the algorithm and the base64 encoded key of a public key
+func (e *encoder) writePublicKey(pk ScpPublicKey) {
+	key, err := base64.StdEncoding.DecodeString(pk.Key)
+	if err != nil {
+		e.setError(err)
+		return
+	}
+	e.writeSpecifier(pk.Algorithm)
+	e.writePrefixedBytes(key)
+}
+
+func (e *encoder) writeBool(b bool) {
+	if b {
+		e.write([]byte{1})
+	} else {
+		e.write([]byte{0})
+	}
+}
+
+//writeCurrency writes a decimal amount as its length-prefixed big-endian bytes
+func (e *encoder) writeCurrency(c string) {
+	value, ok := new(big.Int).SetString(c, 10)
+	if !ok || value.Sign() < 0 {
+		e.setError(errors.New("invalid currency " + c))
+		return
+	}
+	e.writePrefixedBytes(value.Bytes())
+}
+
+//decoder reads values written with the ScPrime binary encoding
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) setError(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *decoder) read(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.b)) {
+		d.setError(io.ErrUnexpectedEOF)
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) readUint64() uint64 {
+	b := d.read(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (d *decoder) readBool() bool {
+	b := d.read(1)
+	if b == nil {
+		return false
+	}
+	if b[0] > 1 {
+		d.setError(errors.New("invalid boolean"))
+	}
+	return b[0] == 1
+}
+
+//readPrefix reads the length of a slice whose elements take at least minSize bytes,
+//rejecting lengths which can't fit in the remaining data
+func (d *decoder) readPrefix(minSize uint64) int {
+	n := d.readUint64()
+	if d.err == nil && n > uint64(len(d.b))/minSize {
+		d.setError(errors.New("invalid slice length"))
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) readPrefixedBytes() []byte {
+	return append([]byte(nil), d.read(uint64(d.readPrefix(1)))...)
+}
+
+//readSpecifier reads a fixed length specifier, dropping its zero padding
+func (d *decoder) readSpecifier() string {
+	return strings.TrimRight(string(d.read(specifierLen)), "\x00")
+}
+
+//readHash reads a hash and returns it hex encoded
+func (d *decoder) readHash() string {
+	return hex.EncodeToString(d.read(hashLen))
+}
+
+//readAddress reads an unlock hash and returns it as an address, with its checksum
+func (d *decoder) readAddress() string {
+	b := d.read(hashLen)
+	if b == nil {
+		return ""
+	}
+	var hash [hashLen]byte
+	copy(hash[:], b)
+	return addressFromHash(hash)
+}
+
+//readCurrency reads a length-prefixed big-endian amount and returns it in decimal
+func (d *decoder) readCurrency() string {
+	return new(big.Int).SetBytes(d.readPrefixedBytes()).String()
+}
+
+//readPublicKey reads a public key, returning its key base64 encoded
+func (d *decoder) readPublicKey() ScpPublicKey {
+	return ScpPublicKey{
+		Algorithm: d.readSpecifier(),
+		Key:       base64.StdEncoding.EncodeToString(d.readPrefixedBytes()),
+	}
+}
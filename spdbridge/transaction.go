@@ -0,0 +1,415 @@
+package spdbridge
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+//Minimum encoded sizes of the transaction elements, used to reject slice lengths which can't fit in the data
+const (
+	minUnlockConditionsLen = 8 + 8 + 8
+	minScpOutputLen        = 8 + hashLen
+	minTransactionLen      = 10 * 8
+)
+
+//Id returns the transaction id, the hash of the transaction encoded without its signatures
+func (t *Transaction) Id() (string, error) {
+
+	var buf bytes.Buffer
+	e := encoder{w: &buf}
+	t.encodeNoSignatures(&e)
+	if e.err != nil {
+		return "", e.err
+	}
+	id := blake2b.Sum256(buf.Bytes())
+	return hex.EncodeToString(id[:]), nil
+
+}
+
+//ScpOutputId returns the id of the transaction's SCP output at index, the one used by the inputs spending it
+func (t *Transaction) ScpOutputId(index uint64) (string, error) {
+	return t.outputId("siacoin output", index)
+}
+
+//SpfOutputId returns the id of the transaction's SPF output at index, the one used by the inputs spending it
+func (t *Transaction) SpfOutputId(index uint64) (string, error) {
+	return t.outputId("siafund output", index)
+}
+
+//FileContractId returns the id of the transaction's file contract at index, the one used by its revisions and storage proof
+func (t *Transaction) FileContractId(index uint64) (string, error) {
+	return t.outputId("file contract", index)
+}
+
+//outputId hashes the specifier of the output type, the transaction without its signatures and the output index
+func (t *Transaction) outputId(specifier string, index uint64) (string, error) {
+
+	var buf bytes.Buffer
+	e := encoder{w: &buf}
+	e.writeSpecifier(specifier)
+	t.encodeNoSignatures(&e)
+	e.writeUint64(index)
+	if e.err != nil {
+		return "", e.err
+	}
+	id := blake2b.Sum256(buf.Bytes())
+	return hex.EncodeToString(id[:]), nil
+
+}
+
+//MinerPayoutId returns the id of the miner payout at index of the block with the id provided
+func MinerPayoutId(blockId string, index uint64) (string, error) {
+
+	var buf bytes.Buffer
+	e := encoder{w: &buf}
+	e.writeHash(blockId)
+	e.writeUint64(index)
+	if e.err != nil {
+		return "", e.err
+	}
+	id := blake2b.Sum256(buf.Bytes())
+	return hex.EncodeToString(id[:]), nil
+
+}
+
+//StorageProofOutputId returns the id of the output at index created by the file contract with the id provided, from
+//its valid proof outputs when the storage proof is submitted or from its missed proof outputs otherwise
+func StorageProofOutputId(contractId string, validProof bool, index uint64) (string, error) {
+
+	var buf bytes.Buffer
+	e := encoder{w: &buf}
+	e.writeSpecifier("storage proof")
+	e.writeHash(contractId)
+	e.writeBool(validProof)
+	e.writeUint64(index)
+	if e.err != nil {
+		return "", e.err
+	}
+	id := blake2b.Sum256(buf.Bytes())
+	return hex.EncodeToString(id[:]), nil
+
+}
+
+//EncodeTransaction returns the ScPrime binary encoding of the transaction
+func EncodeTransaction(t Transaction) ([]byte, error) {
+
+	var buf bytes.Buffer
+	e := encoder{w: &buf}
+	t.encode(&e)
+	return buf.Bytes(), e.err
+
+}
+
+//EncodeTransactions returns the ScPrime binary encoding of the transaction set
+func EncodeTransactions(transactions []Transaction) ([]byte, error) {
+
+	var buf bytes.Buffer
+	e := encoder{w: &buf}
+	e.writeUint64(uint64(len(transactions)))
+	for i := range transactions {
+		transactions[i].encode(&e)
+	}
+	return buf.Bytes(), e.err
+
+}
+
+//DecodeTransaction decodes a transaction from its ScPrime binary encoding
+func DecodeTransaction(b []byte) (*Transaction, error) {
+
+	d := decoder{b: b}
+	var t Transaction
+	t.decode(&d)
+	if d.err == nil && len(d.b) > 0 {
+		d.setError(errors.New("unexpected data after the transaction"))
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return &t, nil
+
+}
+
+//DecodeTransactions decodes a transaction set from its ScPrime binary encoding
+func DecodeTransactions(b []byte) ([]Transaction, error) {
+
+	d := decoder{b: b}
+	transactions := make([]Transaction, d.readPrefix(minTransactionLen))
+	for i := range transactions {
+		transactions[i].decode(&d)
+	}
+	if d.err == nil && len(d.b) > 0 {
+		d.setError(errors.New("unexpected data after the transactions"))
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return transactions, nil
+
+}
+
+//ParseTransaction reads a transaction in any of the formats accepted by spd's /tpool/raw: JSON,
+//base64 encoded binary or raw binary
+func ParseTransaction(data string) (*Transaction, error) {
+
+	var t Transaction
+	if json.Unmarshal([]byte(data), &t) == nil {
+		return &t, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		raw = []byte(data)
+	}
+	return DecodeTransaction(raw)
+
+}
+
+//ParseTransactions is like ParseTransaction for transaction sets
+func ParseTransactions(data string) ([]Transaction, error) {
+
+	var transactions []Transaction
+	if json.Unmarshal([]byte(data), &transactions) == nil {
+		return transactions, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		raw = []byte(data)
+	}
+	return DecodeTransactions(raw)
+
+}
+
+func (t *Transaction) encode(e *encoder) {
+	t.encodeNoSignatures(e)
+	e.writeUint64(uint64(len(t.TransactionSignatures)))
+	for i := range t.TransactionSignatures {
+		t.TransactionSignatures[i].encode(e)
+	}
+}
+
+func (t *Transaction) encodeNoSignatures(e *encoder) {
+
+	e.writeUint64(uint64(len(t.ScpInputs)))
+	for _, input := range t.ScpInputs {
+		e.writeHash(input.ParentId)
+		input.UnlockConditions.encode(e)
+	}
+	e.writeUint64(uint64(len(t.ScpOutputs)))
+	for _, output := range t.ScpOutputs {
+		output.encode(e)
+	}
+	e.writeUint64(uint64(len(t.FileContracts)))
+	for _, fc := range t.FileContracts {
+		e.writeUint64(fc.FileSize)
+		e.writeHash(fc.FileMerkleRoot)
+		e.writeUint64(fc.WindowStart)
+		e.writeUint64(fc.WindowEnd)
+		e.writeCurrency(fc.Payout)
+		encodeScpOutputs(e, fc.ValidProofOutputs)
+		encodeScpOutputs(e, fc.MissedProofOutputs)
+		e.writeHash(fc.UnlockHash)
+		e.writeUint64(fc.RevisionNumber)
+	}
+	e.writeUint64(uint64(len(t.FileContractRevisions)))
+	for _, fcr := range t.FileContractRevisions {
+		e.writeHash(fcr.ParentId)
+		fcr.UnlockConditions.encode(e)
+		e.writeUint64(fcr.NewRevisionNumber)
+		e.writeUint64(fcr.NewFileSize)
+		e.writeHash(fcr.NewFileMerkleRoot)
+		e.writeUint64(fcr.NewWindowStart)
+		e.writeUint64(fcr.NewWindowEnd)
+		encodeScpOutputs(e, fcr.NewValidProofOutputs)
+		encodeScpOutputs(e, fcr.NewMissedProofOutputs)
+		e.writeHash(fcr.NewUnlockHash)
+	}
+	e.writeUint64(uint64(len(t.StorageProofs)))
+	for _, sp := range t.StorageProofs {
+		e.writeHash(sp.ParentId)
+		e.write(sp.Segment[:])
+		e.writeUint64(uint64(len(sp.HashSet)))
+		for _, hash := range sp.HashSet {
+			e.writeHash(hash)
+		}
+	}
+	e.writeUint64(uint64(len(t.SpfInputs)))
+	for _, input := range t.SpfInputs {
+		e.writeHash(input.ParentId)
+		input.UnlockConditions.encode(e)
+		e.writeHash(input.ClaimUnlockHash)
+	}
+	e.writeUint64(uint64(len(t.SpfOutputs)))
+	for _, output := range t.SpfOutputs {
+		e.writeCurrency(output.Value)
+		e.writeHash(output.UnlockHash)
+		e.writeCurrency(output.ClaimStart)
+	}
+	e.writeUint64(uint64(len(t.MinerFees)))
+	for _, fee := range t.MinerFees {
+		e.writeCurrency(fee)
+	}
+	e.writeUint64(uint64(len(t.ArbitraryData)))
+	for _, data := range t.ArbitraryData {
+		e.writePrefixedBytes(data)
+	}
+
+}
+
+func (t *Transaction) decode(d *decoder) {
+
+	t.ScpInputs = make([]ScpInput, d.readPrefix(hashLen+minUnlockConditionsLen))
+	for i := range t.ScpInputs {
+		t.ScpInputs[i].ParentId = d.readHash()
+		t.ScpInputs[i].UnlockConditions.decode(d)
+	}
+	t.ScpOutputs = decodeScpOutputs(d)
+	t.FileContracts = make([]FileContract, d.readPrefix(8+hashLen+8+8+8+8+8+hashLen+8))
+	for i := range t.FileContracts {
+		fc := &t.FileContracts[i]
+		fc.FileSize = d.readUint64()
+		fc.FileMerkleRoot = d.readHash()
+		fc.WindowStart = d.readUint64()
+		fc.WindowEnd = d.readUint64()
+		fc.Payout = d.readCurrency()
+		fc.ValidProofOutputs = decodeScpOutputs(d)
+		fc.MissedProofOutputs = decodeScpOutputs(d)
+		fc.UnlockHash = d.readAddress()
+		fc.RevisionNumber = d.readUint64()
+	}
+	t.FileContractRevisions = make([]FileContractRevision, d.readPrefix(hashLen+minUnlockConditionsLen+8+8+hashLen+8+8+8+8+hashLen))
+	for i := range t.FileContractRevisions {
+		fcr := &t.FileContractRevisions[i]
+		fcr.ParentId = d.readHash()
+		fcr.UnlockConditions.decode(d)
+		fcr.NewRevisionNumber = d.readUint64()
+		fcr.NewFileSize = d.readUint64()
+		fcr.NewFileMerkleRoot = d.readHash()
+		fcr.NewWindowStart = d.readUint64()
+		fcr.NewWindowEnd = d.readUint64()
+		fcr.NewValidProofOutputs = decodeScpOutputs(d)
+		fcr.NewMissedProofOutputs = decodeScpOutputs(d)
+		fcr.NewUnlockHash = d.readAddress()
+	}
+	t.StorageProofs = make([]StorageProof, d.readPrefix(hashLen+storageSegmentLen+8))
+	for i := range t.StorageProofs {
+		sp := &t.StorageProofs[i]
+		sp.ParentId = d.readHash()
+		copy(sp.Segment[:], d.read(storageSegmentLen))
+		sp.HashSet = make([]string, d.readPrefix(hashLen))
+		for j := range sp.HashSet {
+			sp.HashSet[j] = d.readHash()
+		}
+	}
+	t.SpfInputs = make([]SpfInput, d.readPrefix(hashLen+minUnlockConditionsLen+hashLen))
+	for i := range t.SpfInputs {
+		t.SpfInputs[i].ParentId = d.readHash()
+		t.SpfInputs[i].UnlockConditions.decode(d)
+		t.SpfInputs[i].ClaimUnlockHash = d.readAddress()
+	}
+	t.SpfOutputs = make([]SpfOutput, d.readPrefix(8+hashLen+8))
+	for i := range t.SpfOutputs {
+		t.SpfOutputs[i].Value = d.readCurrency()
+		t.SpfOutputs[i].UnlockHash = d.readAddress()
+		t.SpfOutputs[i].ClaimStart = d.readCurrency()
+	}
+	t.MinerFees = make([]string, d.readPrefix(8))
+	for i := range t.MinerFees {
+		t.MinerFees[i] = d.readCurrency()
+	}
+	t.ArbitraryData = make([][]byte, d.readPrefix(8))
+	for i := range t.ArbitraryData {
+		t.ArbitraryData[i] = d.readPrefixedBytes()
+	}
+	t.TransactionSignatures = make([]TransactionSignature, d.readPrefix(hashLen+8+8+1+10*8+8))
+	for i := range t.TransactionSignatures {
+		t.TransactionSignatures[i].decode(d)
+	}
+
+}
+
+func (uc UnlockConditions) encode(e *encoder) {
+	e.writeUint64(uc.Timelock)
+	e.writeUint64(uint64(len(uc.PublicKeys)))
+	for _, pk := range uc.PublicKeys {
+		e.writePublicKey(pk)
+	}
+	e.writeUint64(uc.SignaturesRequired)
+}
+
+func (uc *UnlockConditions) decode(d *decoder) {
+	uc.Timelock = d.readUint64()
+	uc.PublicKeys = make([]ScpPublicKey, d.readPrefix(specifierLen+8))
+	for i := range uc.PublicKeys {
+		uc.PublicKeys[i] = d.readPublicKey()
+	}
+	uc.SignaturesRequired = d.readUint64()
+}
+
+func (o ScpOutput) encode(e *encoder) {
+	e.writeCurrency(o.Value)
+	e.writeHash(o.UnlockHash)
+}
+
+func encodeScpOutputs(e *encoder, outputs []ScpOutput) {
+	e.writeUint64(uint64(len(outputs)))
+	for _, output := range outputs {
+		output.encode(e)
+	}
+}
+
+func decodeScpOutputs(d *decoder) []ScpOutput {
+	outputs := make([]ScpOutput, d.readPrefix(minScpOutputLen))
+	for i := range outputs {
+		outputs[i].Value = d.readCurrency()
+		outputs[i].UnlockHash = d.readAddress()
+	}
+	return outputs
+}
+
+func (ts TransactionSignature) encode(e *encoder) {
+	e.writeHash(ts.ParentId)
+	e.writeUint64(ts.PublicKeyIndex)
+	e.writeUint64(ts.Timelock)
+	cf := ts.CoveredFields
+	e.writeBool(cf.WholeTransaction)
+	for _, field := range cf.fields() {
+		e.writeUint64(uint64(len(*field)))
+		for _, index := range *field {
+			e.writeUint64(index)
+		}
+	}
+	e.writePrefixedBytes(ts.Signature)
+}
+
+func (ts *TransactionSignature) decode(d *decoder) {
+	ts.ParentId = d.readHash()
+	ts.PublicKeyIndex = d.readUint64()
+	ts.Timelock = d.readUint64()
+	ts.CoveredFields.WholeTransaction = d.readBool()
+	for _, field := range ts.CoveredFields.fields() {
+		*field = make([]uint64, d.readPrefix(8))
+		for i := range *field {
+			(*field)[i] = d.readUint64()
+		}
+	}
+	ts.Signature = d.readPrefixedBytes()
+}
+
+//fields returns the covered fields in their encoding order
+func (cf *CoveredFields) fields() []*[]uint64 {
+	return []*[]uint64{
+		&cf.ScpInputs,
+		&cf.ScpOutputs,
+		&cf.FileContracts,
+		&cf.FileContractRevisions,
+		&cf.StorageProofs,
+		&cf.SpfInputs,
+		&cf.SpfOutputs,
+		&cf.MinerFees,
+		&cf.ArbitraryData,
+		&cf.TransactionSignatures,
+	}
+}
@@ -0,0 +1,144 @@
+package spdbridge
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//The test vectors in testdata are generated with the ScPrime types package: transaction.json is a transaction
+//using every field, transaction.b64 its binary encoding and transactionset.b64 the encoding of the set made of
+//that transaction followed by an empty one
+const (
+	testTransactionId      = "8ae62e18a64fc3cde9d3872d49181a98ffd286140017932f456eaa9c397a7121"
+	testEmptyTransactionId = "b3633a1370a72002ae2a956d21e8d481c3a69e146633470cf625ecd83fdeaa24"
+)
+
+func readTestData(t *testing.T, name string) string {
+	data, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestTransactionEncoding(t *testing.T) {
+
+	var transaction Transaction
+	if err := json.Unmarshal([]byte(readTestData(t, "transaction.json")), &transaction); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := base64.StdEncoding.DecodeString(readTestData(t, "transaction.b64"))
+
+	encoded, err := EncodeTransaction(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, expected) {
+		t.Fatal("binary encoding doesn't match spd's")
+	}
+	id, err := transaction.Id()
+	if err != nil || id != testTransactionId {
+		t.Fatalf("expected id %v, got %v %v", testTransactionId, id, err)
+	}
+	parent := Transaction{ArbitraryData: [][]byte{[]byte("parent")}}
+	if outputId, _ := parent.ScpOutputId(3); outputId != "548e72257d8cd95d846a29df49991f4de9f7dc6408454ef30b33459806603f4b" {
+		t.Fatalf("unexpected output id %v", outputId)
+	}
+	if outputId, _ := parent.SpfOutputId(2); outputId != "6212d82042b14dbe70468a7c05a1743efe9abd10ed23d061de3774daaef66573" {
+		t.Fatalf("unexpected SPF output id %v", outputId)
+	}
+	if payoutId, _ := MinerPayoutId("746b03349593d4710d1e8918c3b1212825cbfbdb3cd9923b0e7030648a6ccaa5", 2); payoutId != "5a09dc41deda5e913310fdea31e3744be3029ee2c944366caeb60d56bf6c6281" {
+		t.Fatalf("unexpected miner payout id %v", payoutId)
+	}
+	//The file contract vectors use the address of the hash of "addr"
+	const testContractAddress = "49cdb96d5a413755809cbb6027713c8bad8aaf02df48d2284978c012bf720dcced457a9a1177"
+	contract := Transaction{
+		ScpOutputs: []ScpOutput{{Value: "5", UnlockHash: testContractAddress}},
+		FileContracts: []FileContract{{
+			FileSize: 1, FileMerkleRoot: strings.Repeat("0", 64), WindowStart: 10, WindowEnd: 20, Payout: "100",
+			ValidProofOutputs:  []ScpOutput{{Value: "60", UnlockHash: testContractAddress}},
+			MissedProofOutputs: []ScpOutput{{Value: "40", UnlockHash: testContractAddress}},
+			UnlockHash:         testContractAddress,
+		}},
+	}
+	if contractId, _ := contract.FileContractId(0); contractId != "30002a029b2b4585852ff53ec1c63544093f4e6c9e2893691cf847c7e4b30159" {
+		t.Fatalf("unexpected file contract id %v", contractId)
+	}
+	if outputId, _ := StorageProofOutputId("30002a029b2b4585852ff53ec1c63544093f4e6c9e2893691cf847c7e4b30159", true, 0); outputId != "0cf9e68c1304b7fd11e85c93f3a2b6c4fe0ca3f524b5feab8845476661950e47" {
+		t.Fatalf("unexpected valid proof output id %v", outputId)
+	}
+	if outputId, _ := StorageProofOutputId("30002a029b2b4585852ff53ec1c63544093f4e6c9e2893691cf847c7e4b30159", false, 1); outputId != "74b878ea5fde1d6819e05211caf0a66333ef0bf3c644e276ef0b823f6d6b4fa1" {
+		t.Fatalf("unexpected missed proof output id %v", outputId)
+	}
+	emptyId, _ := (&Transaction{}).Id()
+	if emptyId != testEmptyTransactionId {
+		t.Fatalf("expected id %v, got %v", testEmptyTransactionId, emptyId)
+	}
+
+	decoded, err := DecodeTransaction(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Empty slices decode as empty rather than nil, so the transactions are compared re-encoding them
+	reencoded, err := EncodeTransaction(*decoded)
+	if err != nil || !bytes.Equal(reencoded, expected) {
+		t.Fatal("decoded transaction differs")
+	}
+	if !reflect.DeepEqual(decoded.TransactionSignatures[1].CoveredFields.ScpOutputs, []uint64{0, 1}) ||
+		decoded.StorageProofs[0].Segment[0] != 7 || string(decoded.ArbitraryData[0]) != "hello" ||
+		decoded.SpfInputs[0].ClaimUnlockHash != transaction.SpfInputs[0].ClaimUnlockHash {
+		t.Fatalf("unexpected decoded transaction %+v", *decoded)
+	}
+
+	if _, err := DecodeTransaction(expected[:len(expected)-1]); err == nil {
+		t.Fatal("expected truncated transactions to be rejected")
+	}
+	if _, err := DecodeTransaction(append(expected, 0)); err == nil {
+		t.Fatal("expected trailing data to be rejected")
+	}
+
+}
+
+func TestParseTransactions(t *testing.T) {
+
+	set := readTestData(t, "transactionset.b64")
+	raw, _ := base64.StdEncoding.DecodeString(set)
+
+	for _, data := range []string{set, string(raw)} {
+		transactions, err := ParseTransactions(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(transactions) != 2 {
+			t.Fatalf("expected 2 transactions, got %v", len(transactions))
+		}
+		first, _ := transactions[0].Id()
+		second, _ := transactions[1].Id()
+		if first != testTransactionId || second != testEmptyTransactionId {
+			t.Fatalf("unexpected ids %v %v", first, second)
+		}
+		encoded, err := EncodeTransactions(transactions)
+		if err != nil || !bytes.Equal(encoded, raw) {
+			t.Fatal("transaction set encoding doesn't match spd's")
+		}
+	}
+
+	transaction, err := ParseTransaction(readTestData(t, "transaction.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := transaction.Id(); id != testTransactionId {
+		t.Fatalf("unexpected id %v", id)
+	}
+
+	//A huge slice length must not be allocated
+	if _, err := DecodeTransactions([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}); err == nil {
+		t.Fatal("expected invalid lengths to be rejected")
+	}
+
+}
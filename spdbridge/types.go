@@ -11,16 +11,47 @@ type (
 	}
 
 	ConsensusResp struct {
-		Synced bool   `json:"synced"`
-		Height uint64 `json:"height"`
+		Synced       bool   `json:"synced"`
+		Height       uint64 `json:"height"`
+		CurrentBlock string `json:"currentblock"`
+	}
+
+	ConsensusBlock struct {
+		Id           string                 `json:"id"`
+		Height       uint64                 `json:"height"`
+		ParentId     string                 `json:"parentid"`
+		Difficulty   string                 `json:"difficulty"`
+		Timestamp    uint64                 `json:"timestamp"`
+		MinerPayouts []ScpOutput            `json:"minerpayouts"`
+		Transactions []ConsensusTransaction `json:"transactions"`
 	}
 
 	AddressesBatchResp struct {
 		Addresses []ExplorerAddress `json:"addresses"`
 	}
 
+	ExplorerHashResp struct {
+		HashType     string                `json:"hashtype"`
+		Transaction  ExplorerTransaction   `json:"transaction"`
+		Transactions []ExplorerTransaction `json:"transactions"`
+		Blocks       []ExplorerBlock       `json:"blocks"`
+	}
+
+	TransactionPoolRawResp struct {
+		Id          string `json:"id"`
+		Parents     []byte `json:"parents"`
+		Transaction []byte `json:"transaction"`
+	}
+
+	TransactionPoolConfirmedResp struct {
+		Confirmed bool `json:"confirmed"`
+	}
+
 	TransactionPoolResp struct {
 		Transactions []RawTransaction `json:"transactions"`
+		//Ids and Sizes are the ids and encoded sizes of the transactions, in the same order
+		Ids   []string `json:"-"`
+		Sizes []uint64 `json:"-"`
 	}
 )
 
@@ -28,6 +59,35 @@ type (
 	ExplorerAddress struct {
 		Address      string                `json:"address"`
 		Transactions []ExplorerTransaction `json:"transactions"`
+		//Blocks are the blocks with miner payouts to the address
+		Blocks []ExplorerBlock `json:"blocks"`
+		//ContractPayouts are the outputs of the file contracts paying the address, spd doesn't return them: they're
+		//added from the contracts found in the address transactions
+		ContractPayouts []ExplorerContractPayout `json:"contractpayouts,omitempty"`
+	}
+
+	//ExplorerContractPayout holds the outputs created by a file contract at Height, its valid proof outputs when the
+	//storage proof is submitted or its missed proof outputs when the proof window ends without it
+	ExplorerContractPayout struct {
+		ContractId string      `json:"contractid"`
+		ValidProof bool        `json:"validproof"`
+		Height     uint64      `json:"height"`
+		Timestamp  uint64      `json:"timestamp"`
+		OutputIds  []string    `json:"outputids"`
+		Outputs    []ScpOutput `json:"outputs"`
+	}
+
+	ExplorerBlock struct {
+		BlockId        string           `json:"blockid"`
+		Height         uint64           `json:"height"`
+		MinerPayoutIds []string         `json:"minerpayoutids"`
+		RawBlock       ExplorerRawBlock `json:"rawblock"`
+	}
+
+	//ExplorerRawBlock holds the fields of the block header used by the API, the block transactions are left out
+	ExplorerRawBlock struct {
+		Timestamp    uint64      `json:"timestamp"`
+		MinerPayouts []ScpOutput `json:"minerpayouts"`
 	}
 
 	ExplorerTransaction struct {
@@ -37,10 +97,9 @@ type (
 		Height         uint64         `json:"height"`
 	}
 
-	RawTransaction struct {
-		ScpInputs  []ScpInput  `json:"siacoininputs"`
-		ScpOutputs []ScpOutput `json:"siacoinoutputs"`
-		MinerFees  []string    `json:"minerfees"`
+	ConsensusTransaction struct {
+		Id string `json:"id"`
+		RawTransaction
 	}
 
 	TransactionOutput struct {
@@ -67,6 +126,92 @@ type (
 	}
 
 	ScpPublicKey struct {
-		Key string `json:"key"`
+		Algorithm string `json:"algorithm"`
+		Key       string `json:"key"`
+	}
+)
+
+type (
+	//RawTransaction is a transaction as returned by the spd endpoints, convert it to Transaction to compute its id
+	//or its encoding
+	RawTransaction Transaction
+
+	//Transaction is a complete ScPrime transaction, in the JSON format used by spd
+	Transaction struct {
+		ScpInputs             []ScpInput             `json:"siacoininputs"`
+		ScpOutputs            []ScpOutput            `json:"siacoinoutputs"`
+		FileContracts         []FileContract         `json:"filecontracts"`
+		FileContractRevisions []FileContractRevision `json:"filecontractrevisions"`
+		StorageProofs         []StorageProof         `json:"storageproofs"`
+		SpfInputs             []SpfInput             `json:"siafundinputs"`
+		SpfOutputs            []SpfOutput            `json:"siafundoutputs"`
+		MinerFees             []string               `json:"minerfees"`
+		ArbitraryData         [][]byte               `json:"arbitrarydata"`
+		TransactionSignatures []TransactionSignature `json:"transactionsignatures"`
+	}
+
+	FileContract struct {
+		FileSize           uint64      `json:"filesize"`
+		FileMerkleRoot     string      `json:"filemerkleroot"`
+		WindowStart        uint64      `json:"windowstart"`
+		WindowEnd          uint64      `json:"windowend"`
+		Payout             string      `json:"payout"`
+		ValidProofOutputs  []ScpOutput `json:"validproofoutputs"`
+		MissedProofOutputs []ScpOutput `json:"missedproofoutputs"`
+		UnlockHash         string      `json:"unlockhash"`
+		RevisionNumber     uint64      `json:"revisionnumber"`
+	}
+
+	FileContractRevision struct {
+		ParentId              string           `json:"parentid"`
+		UnlockConditions      UnlockConditions `json:"unlockconditions"`
+		NewRevisionNumber     uint64           `json:"newrevisionnumber"`
+		NewFileSize           uint64           `json:"newfilesize"`
+		NewFileMerkleRoot     string           `json:"newfilemerkleroot"`
+		NewWindowStart        uint64           `json:"newwindowstart"`
+		NewWindowEnd          uint64           `json:"newwindowend"`
+		NewValidProofOutputs  []ScpOutput      `json:"newvalidproofoutputs"`
+		NewMissedProofOutputs []ScpOutput      `json:"newmissedproofoutputs"`
+		NewUnlockHash         string           `json:"newunlockhash"`
+	}
+
+	StorageProof struct {
+		ParentId string                  `json:"parentid"`
+		Segment  [storageSegmentLen]byte `json:"segment"`
+		HashSet  []string                `json:"hashset"`
+	}
+
+	SpfInput struct {
+		ParentId         string           `json:"parentid"`
+		UnlockConditions UnlockConditions `json:"unlockconditions"`
+		ClaimUnlockHash  string           `json:"claimunlockhash"`
+	}
+
+	SpfOutput struct {
+		Value      string `json:"value"`
+		UnlockHash string `json:"unlockhash"`
+		ClaimStart string `json:"claimstart"`
+	}
+
+	TransactionSignature struct {
+		ParentId       string        `json:"parentid"`
+		PublicKeyIndex uint64        `json:"publickeyindex"`
+		Timelock       uint64        `json:"timelock"`
+		CoveredFields  CoveredFields `json:"coveredfields"`
+		Signature      []byte        `json:"signature"`
+	}
+
+	CoveredFields struct {
+		WholeTransaction      bool     `json:"wholetransaction"`
+		ScpInputs             []uint64 `json:"siacoininputs"`
+		ScpOutputs            []uint64 `json:"siacoinoutputs"`
+		FileContracts         []uint64 `json:"filecontracts"`
+		FileContractRevisions []uint64 `json:"filecontractrevisions"`
+		StorageProofs         []uint64 `json:"storageproofs"`
+		SpfInputs             []uint64 `json:"siafundinputs"`
+		SpfOutputs            []uint64 `json:"siafundoutputs"`
+		MinerFees             []uint64 `json:"minerfees"`
+		ArbitraryData         []uint64 `json:"arbitrarydata"`
+		TransactionSignatures []uint64 `json:"transactionsignatures"`
 	}
 )
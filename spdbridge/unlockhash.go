@@ -0,0 +1,102 @@
+package spdbridge
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+//addressChecksumLen is the length of the checksum appended to the unlock hash in its string form
+const addressChecksumLen = 6
+
+//UnlockHash computes the address corresponding to the unlock conditions, which is the merkle root
+//of the timelock, the public keys and the number of signatures required
+func (uc UnlockConditions) UnlockHash() (string, error) {
+
+	var leaves [][]byte
+	var buf bytes.Buffer
+	e := encoder{w: &buf}
+
+	e.writeUint64(uc.Timelock)
+	leaves = append(leaves, append([]byte(nil), buf.Bytes()...))
+	for _, pk := range uc.PublicKeys {
+		buf.Reset()
+		e.writePublicKey(pk)
+		leaves = append(leaves, append([]byte(nil), buf.Bytes()...))
+	}
+	buf.Reset()
+	e.writeUint64(uc.SignaturesRequired)
+	leaves = append(leaves, append([]byte(nil), buf.Bytes()...))
+	if e.err != nil {
+		return "", e.err
+	}
+
+	return addressFromHash(merkleRoot(leaves)), nil
+
+}
+
+//ValidateAddress checks that address is a hex encoded unlock hash followed by its valid checksum
+func ValidateAddress(address string) error {
+
+	if len(address) != (hashLen+addressChecksumLen)*2 {
+		return errors.New("invalid address length")
+	}
+	decoded, err := hex.DecodeString(address)
+	if err != nil {
+		return errors.New("invalid address encoding")
+	}
+
+	var hash [hashLen]byte
+	copy(hash[:], decoded)
+	if addressFromHash(hash) != address {
+		return errors.New("invalid address checksum")
+	}
+	return nil
+
+}
+
+//addressFromHash formats an unlock hash as an address, appending its checksum
+func addressFromHash(hash [hashLen]byte) string {
+	checksum := blake2b.Sum256(hash[:])
+	return hex.EncodeToString(hash[:]) + hex.EncodeToString(checksum[:addressChecksumLen])
+}
+
+//merkleRoot computes the root of the blake2b merkle tree built on the leaves provided.
+//Leaves and nodes are domain separated with a 0 and 1 prefix, and when the number of leaves isn't a power of two
+//the smaller subtrees are joined from the right, as in the ScPrime merkle tree
+func merkleRoot(leaves [][]byte) [hashLen]byte {
+
+	type subTree struct {
+		height int
+		sum    [hashLen]byte
+	}
+
+	var stack []subTree
+	for _, leaf := range leaves {
+		current := subTree{sum: blake2b.Sum256(append([]byte{0}, leaf...))}
+		for len(stack) > 0 && stack[len(stack)-1].height == current.height {
+			current = subTree{height: current.height + 1, sum: nodeSum(stack[len(stack)-1].sum, current.sum)}
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, current)
+	}
+
+	if len(stack) == 0 {
+		return [hashLen]byte{}
+	}
+	root := stack[len(stack)-1].sum
+	for i := len(stack) - 2; i >= 0; i-- {
+		root = nodeSum(stack[i].sum, root)
+	}
+	return root
+
+}
+
+func nodeSum(left [hashLen]byte, right [hashLen]byte) [hashLen]byte {
+	data := make([]byte, 0, 1+2*hashLen)
+	data = append(data, 1)
+	data = append(data, left[:]...)
+	data = append(data, right[:]...)
+	return blake2b.Sum256(data)
+}
@@ -0,0 +1,67 @@
+package spdbridge
+
+import (
+	"testing"
+)
+
+//Expected addresses have been computed with the ScPrime types package
+func TestUnlockHash(t *testing.T) {
+
+	tests := []struct {
+		uc      UnlockConditions
+		address string
+	}{
+		{
+			uc:      UnlockConditions{},
+			address: "10628d8f8233d6a5afe65df26e6f82d61cbb8e7083056a061ce30705ec68dffb2c54c1371025",
+		},
+		{
+			uc: UnlockConditions{
+				Timelock:           5,
+				SignaturesRequired: 1,
+				PublicKeys: []ScpPublicKey{
+					{Algorithm: "ed25519", Key: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+					{Algorithm: "ed25519", Key: "AQID"},
+				},
+			},
+			address: "898ffe66dbcddd36cb88fc2808dfea399d77fe2eb253654cbda06a8150651a9b2056b659a987",
+		},
+	}
+
+	for _, test := range tests {
+		address, err := test.uc.UnlockHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if address != test.address {
+			t.Fatalf("expected address %v, got %v", test.address, address)
+		}
+	}
+
+	_, err := UnlockConditions{PublicKeys: []ScpPublicKey{{Algorithm: "ed25519", Key: "not base64"}}}.UnlockHash()
+	if err == nil {
+		t.Fatal("expected an error for an invalid key")
+	}
+
+}
+
+func TestValidateAddress(t *testing.T) {
+
+	valid := "898ffe66dbcddd36cb88fc2808dfea399d77fe2eb253654cbda06a8150651a9b2056b659a987"
+	if err := ValidateAddress(valid); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []string{
+		"",
+		valid[:74],
+		"898ffe66dbcddd36cb88fc2808dfea399d77fe2eb253654cbda06a8150651a9b2056b659a988",
+		"z98ffe66dbcddd36cb88fc2808dfea399d77fe2eb253654cbda06a8150651a9b2056b659a987",
+	}
+	for _, address := range invalid {
+		if ValidateAddress(address) == nil {
+			t.Fatalf("address %v should be invalid", address)
+		}
+	}
+
+}